@@ -10,8 +10,9 @@ type Node interface {
 
 // Ident contains information about some identifier
 type Ident struct {
-	Name string
-	pos  token.Pos
+	Name   string
+	Fields *IdentList // embedded fields of related source, e.g. name and email in customer(name,email)
+	pos    token.Pos
 }
 
 // NewIdent returns new Ident
@@ -19,6 +20,12 @@ func NewIdent(name string, pos token.Pos) *Ident {
 	return &Ident{Name: name, pos: pos}
 }
 
+// WithFields set embedded fields of related source
+func (i *Ident) WithFields(fields *IdentList) *Ident {
+	i.Fields = fields
+	return i
+}
+
 // Pos return position
 func (i *Ident) Pos() token.Pos { return i.pos }
 
@@ -198,3 +205,74 @@ func (e *UnaryExpr) Pos() token.Pos { return e.pos }
 
 // Token return token
 func (e *UnaryExpr) Token() token.Token { return e.Op }
+
+// CallExpr contains function name and arguments, e.g. startof(month)
+type CallExpr struct {
+	Func *Ident
+	Args []Expr
+	pos  token.Pos
+}
+
+// NewCallExpr returns new CallExpr
+func NewCallExpr(fn *Ident, pos token.Pos, args ...Expr) *CallExpr {
+	return &CallExpr{Func: fn, Args: args, pos: pos}
+}
+
+// Pos return position
+func (e *CallExpr) Pos() token.Pos { return e.pos }
+
+// Token return token
+func (e *CallExpr) Token() token.Token { return token.LPAREN }
+
+// Quantifier is a any, all or none
+type Quantifier string
+
+// consts
+const (
+	QuantAny  Quantifier = "any"
+	QuantAll  Quantifier = "all"
+	QuantNone Quantifier = "none"
+)
+
+// QuantifiedExpr contains quantifier and expression, e.g. any{1,2} or all 90
+type QuantifiedExpr struct {
+	Quantifier Quantifier
+	X          Expr
+	pos        token.Pos
+}
+
+// NewQuantifiedExpr returns new QuantifiedExpr
+func NewQuantifiedExpr(quantifier Quantifier, x Expr, pos token.Pos) *QuantifiedExpr {
+	return &QuantifiedExpr{Quantifier: quantifier, X: x, pos: pos}
+}
+
+// Pos return position
+func (e *QuantifiedExpr) Pos() token.Pos { return e.pos }
+
+// Token return token
+func (e *QuantifiedExpr) Token() token.Token { return token.IDENT }
+
+// SubqueryExpr contains reference to related source with optional condition,
+// e.g. orders?{status="open"} or to its field, e.g. @orders.customer_id?status="open"
+type SubqueryExpr struct {
+	Relation *Ident
+	Field    *Ident
+	Cond     Expr
+	pos      token.Pos
+}
+
+// NewSubqueryExpr returns new SubqueryExpr
+func NewSubqueryExpr(relation, field *Ident, cond Expr, pos token.Pos) *SubqueryExpr {
+	return &SubqueryExpr{Relation: relation, Field: field, Cond: cond, pos: pos}
+}
+
+// Pos return position
+func (e *SubqueryExpr) Pos() token.Pos { return e.pos }
+
+// Token return token
+func (e *SubqueryExpr) Token() token.Token {
+	if e.Field != nil {
+		return token.AT
+	}
+	return token.QUERY
+}
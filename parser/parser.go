@@ -78,6 +78,13 @@ func (p *Parser) next() {
 	p.pos, p.tok, p.lit = p.scanner.Scan()
 }
 
+// peek returns next token without moving the scanner
+func (p *Parser) peek() token.Token {
+	s := p.scanner
+	_, tok, _ := s.Scan()
+	return tok
+}
+
 // return error "unexpected ... at ..."
 func (p *Parser) unexpect() error {
 	return fmt.Errorf("unexpected %v at %v", p.tok, p.pos)
@@ -96,11 +103,8 @@ func (p *Parser) parseIdent() (ast.Expr, error) {
 
 // parsePathAndFields return list of path identifiers
 func (p *Parser) parseFields(alreadyIdent *ast.Ident) (*ast.IdentList, error) {
-	var ident *ast.Ident
+	ident := alreadyIdent
 	fields := ast.NewIdentList()
-	if alreadyIdent != nil {
-		fields.Append(alreadyIdent)
-	}
 
 	for p.tok != token.AT {
 		switch p.tok {
@@ -114,9 +118,19 @@ func (p *Parser) parseFields(alreadyIdent *ast.Ident) (*ast.IdentList, error) {
 			if !ok {
 				return nil, p.unexpect()
 			}
-		case token.COMMA, token.EOF:
+		case token.LPAREN:
+			if ident == nil || ident.Fields != nil {
+				return nil, p.unexpect()
+			}
+			embedded, err := p.parseEmbeddedFields()
+			if err != nil {
+				return nil, err
+			}
+			ident.WithFields(embedded)
+		case token.COMMA:
 			if ident != nil {
 				fields.Append(ident)
+				ident = nil
 			}
 		default:
 			return nil, p.unexpect()
@@ -132,6 +146,42 @@ func (p *Parser) parseFields(alreadyIdent *ast.Ident) (*ast.IdentList, error) {
 	return fields, nil
 }
 
+// parseEmbeddedFields return list of fields of related source like (name,email)
+func (p *Parser) parseEmbeddedFields() (*ast.IdentList, error) {
+	var ident *ast.Ident
+	fields := ast.NewIdentList()
+	for {
+		p.next()
+		switch p.tok {
+		case token.IDENT:
+			if ident != nil {
+				return nil, p.unexpect()
+			}
+			ident = ast.NewIdent(p.lit, p.pos)
+		case token.LPAREN:
+			if ident == nil || ident.Fields != nil {
+				return nil, p.unexpect()
+			}
+			embedded, err := p.parseEmbeddedFields()
+			if err != nil {
+				return nil, err
+			}
+			ident.WithFields(embedded)
+		case token.COMMA, token.RPAREN:
+			if ident == nil {
+				return nil, p.unexpect()
+			}
+			fields.Append(ident)
+			ident = nil
+			if p.tok == token.RPAREN {
+				return fields, nil
+			}
+		default:
+			return nil, p.unexpect()
+		}
+	}
+}
+
 // parsePathAndFields return list of path and fields identifiers
 func (p *Parser) parsePathAndFields() (string, *ast.IdentList, error) {
 	var path []string
@@ -158,7 +208,7 @@ func (p *Parser) parsePathAndFields() (string, *ast.IdentList, error) {
 				path = append(path, ident.Name)
 				ident = nil
 			}
-		case token.AT, token.COMMA:
+		case token.AT, token.COMMA, token.LPAREN:
 			if prev == token.IDENT && ident != nil {
 				fields, err = p.parseFields(ident)
 			} else {
@@ -207,9 +257,33 @@ func (p *Parser) parseExpr() (ast.Expr, bool, error) {
 func (p *Parser) parseUnaryExpr() (ast.Expr, bool, error) {
 	switch p.tok {
 	case token.IDENT:
+		if p.peek() == token.LPAREN {
+			expr, err := p.parseCallExpr()
+			return expr, false, err
+		}
+		if p.peek() == token.QUERY {
+			expr, err := p.parseSubqueryExpr()
+			return expr, false, err
+		}
+		if isQuantifier(p.lit) {
+			switch p.peek() {
+			case token.LBRACE, token.INT, token.FLOAT, token.STRING, token.IDENT, token.MINUS:
+				expr, err := p.parseQuantifiedExpr()
+				return expr, false, err
+			}
+		}
 		expr, err := p.parseIdent()
 		return expr, false, err
-	case token.INT, token.FLOAT, token.STRING:
+	case token.PSEUDO:
+		if p.peek() == token.LPAREN {
+			expr, err := p.parseCallExpr()
+			return expr, false, err
+		}
+		return ast.NewIdent("$"+p.lit, p.pos), false, nil
+	case token.AT:
+		expr, err := p.parseSubqueryExpr()
+		return expr, false, err
+	case token.INT, token.FLOAT, token.STRING, token.INTERVAL:
 		return ast.NewConst(p.lit, p.pos, p.tok), false, nil
 	case token.LBRACE:
 		expr, err := p.parseExprList()
@@ -248,6 +322,96 @@ func (p *Parser) parseBinaryExpr(x ast.Expr) (ast.Expr, bool, error) {
 	return expr, isIsolated, nil
 }
 
+// parseCallExpr return function call like startof(month) or $exists(orders)
+func (p *Parser) parseCallExpr() (ast.Expr, error) {
+	name := p.lit
+	if p.tok == token.PSEUDO {
+		name = "$" + name
+	}
+	call := ast.NewCallExpr(ast.NewIdent(name, p.pos), p.pos)
+	p.next()
+	if p.peek() == token.RPAREN {
+		p.next()
+		return call, nil
+	}
+	for p.tok != token.RPAREN {
+		expr, _, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if expr == nil || (p.tok != token.COMMA && p.tok != token.RPAREN) {
+			return nil, p.unexpect()
+		}
+		call.Args = append(call.Args, expr)
+	}
+	return call, nil
+}
+
+// parseSubqueryExpr return reference to related source like orders?{status="open"}
+// or to its field like @orders.customer_id?status="open".
+// Condition is a list, an expression in parentheses or a single comparison
+func (p *Parser) parseSubqueryExpr() (ast.Expr, error) {
+	pos := p.pos
+	var field *ast.Ident
+	if p.tok == token.AT {
+		p.next()
+		if p.tok != token.IDENT {
+			return nil, p.unexpect()
+		}
+		i := strings.Index(p.lit, ".")
+		if i <= 0 || i == len(p.lit)-1 {
+			return nil, p.unexpect()
+		}
+		field = ast.NewIdent(p.lit[i+1:], p.pos+token.Pos(i+1))
+		p.lit = p.lit[:i]
+	}
+	sub := ast.NewSubqueryExpr(ast.NewIdent(p.lit, p.pos), field, nil, pos)
+	if p.peek() != token.QUERY {
+		return sub, nil
+	}
+	p.next()
+	p.next()
+	x, isIsolated, err := p.parseUnaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := x.(*ast.ExprList); ok || isIsolated || !p.peek().IsOperator() {
+		sub.Cond = x
+		return sub, nil
+	}
+	p.next()
+	expr := ast.NewBinaryExpr(p.tok, x, nil, p.pos)
+	p.next()
+	y, _, err := p.parseUnaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	expr.Y = y
+	sub.Cond = expr
+	return sub, nil
+}
+
+// parseQuantifiedExpr return expression with quantifier like any{1,2} or all 90
+func (p *Parser) parseQuantifiedExpr() (ast.Expr, error) {
+	quantified := ast.NewQuantifiedExpr(ast.Quantifier(p.lit), nil, p.pos)
+	p.next()
+	x, _, err := p.parseUnaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	quantified.X = x
+	return quantified, nil
+}
+
+func isQuantifier(lit string) bool {
+	switch ast.Quantifier(lit) {
+	case ast.QuantAny, ast.QuantAll, ast.QuantNone:
+		return true
+	default:
+		return false
+	}
+}
+
 func (p *Parser) parseExprList() (ast.Expr, error) {
 	exprList := ast.NewExprList(p.pos)
 	for {
@@ -314,9 +478,17 @@ func needSwap(x *ast.BinaryExpr, y ast.Expr) bool {
 	if !ok {
 		return false
 	}
+	if isAdditive(x.Op) && isAdditive(yBinaryExpr.Op) {
+		// arithmetic is left-associative: a-b+c is (a-b)+c
+		return true
+	}
 	return x.Op.Precedence() > yBinaryExpr.Op.Precedence()
 }
 
+func isAdditive(op token.Token) bool {
+	return op == token.PLUS || op == token.MINUS
+}
+
 func swap(x, y *ast.BinaryExpr) {
 	*x = *ast.NewBinaryExpr(y.Op, ast.NewBinaryExpr(x.Op, x.X, y.X, x.Pos()), y.Y, y.Pos())
 
@@ -344,10 +516,14 @@ func (p *Parser) parseOrderByStmt() (*ast.OrderByStmtList, error) {
 				dir = ast.NewOrderByDir(ast.OrderDesc, p.pos, p.tok)
 			}
 			p.next()
-			if p.tok != token.IDENT {
+			switch p.tok {
+			case token.IDENT:
+				orderBy.Append(ast.NewOrderByStmt(ast.NewIdent(p.lit, p.pos), dir))
+			case token.PSEUDO:
+				orderBy.Append(ast.NewOrderByStmt(ast.NewIdent("$"+p.lit, p.pos), dir))
+			default:
 				return nil, p.unexpect()
 			}
-			orderBy.Append(ast.NewOrderByStmt(ast.NewIdent(p.lit, p.pos), dir))
 		default:
 			return nil, p.unexpect()
 		}
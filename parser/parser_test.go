@@ -26,6 +26,19 @@ var cases = []struct {
 	{Name: "Short path with field", Src: "/field@foo", Path: "foo", Fields: ast.NewIdentList(ast.NewIdent("field", 1))},
 	{Name: "Short path with 2 fields", Src: "/field1,field2@foo", Path: "foo", Fields: ast.NewIdentList(ast.NewIdent("field1", 1), ast.NewIdent("field2", 8))},
 	{Name: "Short path with 3 fields", Src: "/field1,field2,field3@foo", Path: "foo", Fields: ast.NewIdentList(ast.NewIdent("field1", 1), ast.NewIdent("field2", 8), ast.NewIdent("field3", 15))},
+	{
+		Name: "Short path with embedded fields",
+		Src:  "/id,customer(name,email),items(sku,product(name))@orders",
+		Path: "orders",
+		Fields: ast.NewIdentList(
+			ast.NewIdent("id", 1),
+			ast.NewIdent("customer", 4).WithFields(ast.NewIdentList(ast.NewIdent("name", 13), ast.NewIdent("email", 18))),
+			ast.NewIdent("items", 25).WithFields(ast.NewIdentList(
+				ast.NewIdent("sku", 31),
+				ast.NewIdent("product", 35).WithFields(ast.NewIdentList(ast.NewIdent("name", 43))),
+			)),
+		),
+	},
 
 	{Name: "Query. 1 expr", Src: `/foo?a="b"`, Path: "foo", Expr: ast.NewBinaryExpr(token.EQL, ast.NewIdent("a", 5), ast.NewConst("b", 7, token.STRING), 6)},
 	{Name: "Query. 1 expr (negative int)", Src: `/foo?a=-1`, Path: "foo", Expr: ast.NewBinaryExpr(token.EQL, ast.NewIdent("a", 5), ast.NewUnaryExpr(token.MINUS, ast.NewConst("1", 8, token.INT), 7), 6)},
@@ -262,6 +275,123 @@ var cases = []struct {
 			26,
 		),
 	},
+	{
+		Name: "Query. Relative time",
+		Src:  `/foo?a>now-7d`,
+		Path: "foo",
+		Expr: ast.NewBinaryExpr(
+			token.GTR,
+			ast.NewIdent("a", 5),
+			ast.NewBinaryExpr(token.MINUS, ast.NewIdent("now", 7), ast.NewConst("7d", 11, token.INTERVAL), 10),
+			6,
+		),
+	},
+	{
+		Name: "Query. Relative time with function",
+		Src:  `/foo?a<startof(month)+1M-1d`,
+		Path: "foo",
+		Expr: ast.NewBinaryExpr(
+			token.LSS,
+			ast.NewIdent("a", 5),
+			ast.NewBinaryExpr(
+				token.MINUS,
+				ast.NewBinaryExpr(
+					token.PLUS,
+					ast.NewCallExpr(ast.NewIdent("startof", 7), 7, ast.NewIdent("month", 15)),
+					ast.NewConst("1M", 22, token.INTERVAL),
+					21,
+				),
+				ast.NewConst("1d", 25, token.INTERVAL),
+				24,
+			),
+			6,
+		),
+	},
+	{
+		Name: "Query. Function call",
+		Src:  `/foo?!has(a.b)&a.c=null`,
+		Path: "foo",
+		Expr: ast.NewBinaryExpr(
+			token.AND,
+			ast.NewUnaryExpr(token.NOT, ast.NewCallExpr(ast.NewIdent("has", 6), 6, ast.NewIdent("a.b", 10)), 5),
+			ast.NewBinaryExpr(token.EQL, ast.NewIdent("a.c", 15), ast.NewIdent("null", 19), 18),
+			14,
+		),
+	},
+	{
+		Name: "Query. String matching",
+		Src:  `/foo?a^="b"|a~*="c"`,
+		Path: "foo",
+		Expr: ast.NewBinaryExpr(
+			token.OR,
+			ast.NewBinaryExpr(token.PREFIX, ast.NewIdent("a", 5), ast.NewConst("b", 8, token.STRING), 6),
+			ast.NewBinaryExpr(token.ILIKE, ast.NewIdent("a", 12), ast.NewConst("c", 16, token.STRING), 13),
+			11,
+		),
+	},
+	{
+		Name: "Query. Quantifiers",
+		Src:  `/foo?a=all{"a","b"}&b>any 90&length(a)>2`,
+		Path: "foo",
+		Expr: ast.NewBinaryExpr(
+			token.AND,
+			ast.NewBinaryExpr(
+				token.EQL,
+				ast.NewIdent("a", 5),
+				ast.NewQuantifiedExpr(ast.QuantAll, ast.NewExprList(10, ast.NewConst("a", 11, token.STRING), ast.NewConst("b", 15, token.STRING)), 7),
+				6,
+			),
+			ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.GTR, ast.NewIdent("b", 20), ast.NewQuantifiedExpr(ast.QuantAny, ast.NewConst("90", 26, token.INT), 22), 21),
+				ast.NewBinaryExpr(token.GTR, ast.NewCallExpr(ast.NewIdent("length", 29), 29, ast.NewIdent("a", 36)), ast.NewConst("2", 39, token.INT), 38),
+				28,
+			),
+			19,
+		),
+	},
+	{
+		Name: "Query. Subqueries",
+		Src:  `/customers?$exists(orders?{customer_id=id,status="open"})&id!=@orders.customer_id?total>100`,
+		Path: "customers",
+		Expr: ast.NewBinaryExpr(
+			token.AND,
+			ast.NewCallExpr(ast.NewIdent("$exists", 11), 11, ast.NewSubqueryExpr(
+				ast.NewIdent("orders", 19),
+				nil,
+				ast.NewExprList(26,
+					ast.NewBinaryExpr(token.EQL, ast.NewIdent("customer_id", 27), ast.NewIdent("id", 39), 38),
+					ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 42), ast.NewConst("open", 49, token.STRING), 48),
+				),
+				19,
+			)),
+			ast.NewBinaryExpr(
+				token.NEQ,
+				ast.NewIdent("id", 58),
+				ast.NewSubqueryExpr(
+					ast.NewIdent("orders", 63),
+					ast.NewIdent("customer_id", 70),
+					ast.NewBinaryExpr(token.GTR, ast.NewIdent("total", 82), ast.NewConst("100", 88, token.INT), 87),
+					62,
+				),
+				60,
+			),
+			57,
+		),
+	},
+	{
+		Name: "Query. Subquery with outer column",
+		Src:  `/customers?$exists(orders?{customer_id=$outer.id})`,
+		Path: "customers",
+		Expr: ast.NewCallExpr(ast.NewIdent("$exists", 11), 11, ast.NewSubqueryExpr(
+			ast.NewIdent("orders", 19),
+			nil,
+			ast.NewExprList(26,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("customer_id", 27), ast.NewIdent("$outer.id", 39), 38),
+			),
+			19,
+		)),
+	},
 	{
 		Name: "Sort. One field",
 		Src:  "/foo:+a",
@@ -299,6 +429,23 @@ var cases = []struct {
 			),
 		),
 	},
+	{
+		Name: "Sort. Pseudo field",
+		Src:  `/foo?body@@"fast"&$search="cheap":-$rank`,
+		Path: "foo",
+		Expr: ast.NewBinaryExpr(
+			token.AND,
+			ast.NewBinaryExpr(token.MATCH, ast.NewIdent("body", 5), ast.NewConst("fast", 11, token.STRING), 9),
+			ast.NewBinaryExpr(token.EQL, ast.NewIdent("$search", 18), ast.NewConst("cheap", 26, token.STRING), 25),
+			17,
+		),
+		OrderBy: ast.NewOrderByStmtList(
+			ast.NewOrderByStmt(
+				ast.NewIdent("$rank", 35),
+				ast.NewOrderByDir(ast.OrderDesc, 34, token.MINUS),
+			),
+		),
+	},
 	{
 		Name:  "Limits. No",
 		Src:   "/foo[:]",
@@ -355,8 +502,13 @@ func TestParse(t *testing.T) {
 				t.Fail()
 			}
 
-			if fields := query.Fields(); !reflect.DeepEqual(c.Fields, fields) {
-				t.Errorf("expected fields: %v, got: %v", c.Fields, fields)
+			// Fields of query without fields is an empty list, not nil
+			expectedFields := c.Fields
+			if expectedFields == nil {
+				expectedFields = ast.NewIdentList()
+			}
+			if fields := query.Fields(); !reflect.DeepEqual(expectedFields, fields) {
+				t.Errorf("expected fields: %v, got: %v", expectedFields, fields)
 				t.Fail()
 			}
 
@@ -0,0 +1,224 @@
+package query
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+// compileArrayElements returns set of elements of compiled array column as e(v) for using in from
+func (q *Query) compileArrayElements(column *source.Col, compiledX string) string {
+	if isNative(column) {
+		return "unnest(" + compiledX + ") e(v)"
+	}
+	return "jsonb_array_elements_text(" + compiledX + "::jsonb) e(v)"
+}
+
+// compileArrayElement returns element of array column from compileArrayElements
+func (q *Query) compileArrayElement(column *source.Col) string {
+	if isNative(column) {
+		return "e.v"
+	}
+	return "e.v::" + q.compileType(column.Type)
+}
+
+// compileQuantified returns set or element-wise predicate on array column,
+// e.g. tags=any{"a","b"} or scores>all 90
+func (q *Query) compileQuantified(expr *ast.BinaryExpr, x *ast.Ident, y *ast.QuantifiedExpr) (string, error) {
+	column := q.source.Cols.ByName(x.Name)
+	if column == nil {
+		return "", q.notDefined(x.Name, x.Pos())
+	}
+	if !column.IsArray {
+		return "", q.mustBe(x.Name, "array", "any", x.Pos())
+	}
+	if isNative(column) {
+		if err := q.checkNative(column, x.Pos()); err != nil {
+			return "", err
+		}
+	}
+	if column.Storage == source.StorageTable && column.Type != source.TypeObject {
+		return "", q.mustBe(x.Name, "array of object", "array stored in child table", x.Pos())
+	}
+	var compiledX string
+	if column.Storage != source.StorageTable {
+		var err error
+		compiledX, err = q.compileIdent(x)
+		if err != nil {
+			return "", err
+		}
+	}
+	list, ok := y.X.(*ast.ExprList)
+	if column.Type == source.TypeObject {
+		if !ok {
+			return "", q.mustBe(x.Name, "compared with {...}", y.X.Token().String(), y.X.Pos())
+		}
+		if expr.Op != token.EQL && expr.Op != token.NEQ {
+			return "", q.mustBe(expr.Op.String(), "= or !=", "any", expr.Pos())
+		}
+		var compiled string
+		var err error
+		if column.Storage == source.StorageTable {
+			compiled, err = q.compileChildFilter(list, column, y.Quantifier, x.Pos())
+		} else {
+			compiled, err = q.compileArrayOfObjectFilter(list, column, compiledX+"::jsonb", y.Quantifier, 0)
+		}
+		if err != nil {
+			return "", err
+		}
+		if expr.Op == token.NEQ {
+			return "not (" + compiled + ")", nil
+		}
+		return compiled, nil
+	}
+	if !ok {
+		return q.compileElementComparison(expr.Op, column, compiledX, y.Quantifier, y.X)
+	}
+	if expr.Op != token.EQL && expr.Op != token.NEQ {
+		return "", q.mustBe(expr.Op.String(), "= or !=", "any", expr.Pos())
+	}
+	compiled, err := q.compileArraySet(column, compiledX, y.Quantifier, list)
+	if err != nil {
+		return "", err
+	}
+	if expr.Op == token.NEQ {
+		return "not (" + compiled + ")", nil
+	}
+	return compiled, nil
+}
+
+// compileArraySet returns check that array column contains all, any or none of values
+func (q *Query) compileArraySet(column *source.Col, compiledX string, quantifier ast.Quantifier, list *ast.ExprList) (string, error) {
+	if len(list.Exprs) == 0 {
+		return "", q.mustBe(column.Name, "compared with not empty list", "empty", list.Pos())
+	}
+	values := make([]string, len(list.Exprs))
+	for i, el := range list.Exprs {
+		compiled, err := q.compileValue(column, el)
+		if err != nil {
+			return "", err
+		}
+		values[i] = compiled
+	}
+	switch quantifier {
+	case ast.QuantAll:
+		if isNative(column) {
+			return compiledX + " @> " + q.compileNativeArray(column, values), nil
+		}
+		return compiledX + " @> " + jsonArrayOf(values), nil
+	case ast.QuantAny:
+		return "exists (select 1 from " + q.compileArrayElements(column, compiledX) + " where " + q.compileArrayElement(column) + " in (" + strings.Join(values, ", ") + "))", nil
+	case ast.QuantNone:
+		return "not exists (select 1 from " + q.compileArrayElements(column, compiledX) + " where " + q.compileArrayElement(column) + " in (" + strings.Join(values, ", ") + "))", nil
+	default:
+		return "", q.notDefined(string(quantifier), list.Pos())
+	}
+}
+
+// compileElementComparison returns check that any, all or none of elements of array column
+// satisfies comparison with value
+func (q *Query) compileElementComparison(op token.Token, column *source.Col, compiledX string, quantifier ast.Quantifier, y ast.Expr) (string, error) {
+	element := q.compileArrayElement(column)
+	var cond string
+	if op.IsPattern() {
+		var err error
+		cond, err = q.compilePattern(op, column, element, y)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		switch op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		default:
+			return "", q.unexpect(op, y.Pos())
+		}
+		compiledY, err := q.compileValue(column, y)
+		if err != nil {
+			return "", err
+		}
+		compiledOp, compiledElement, compiledY, err := q.compileOperator(op, element, compiledY, false)
+		if err != nil {
+			return "", err
+		}
+		cond = compiledElement + " " + compiledOp + " " + compiledY
+	}
+	elements := q.compileArrayElements(column, compiledX)
+	switch quantifier {
+	case ast.QuantAny:
+		return "exists (select 1 from " + elements + " where " + cond + ")", nil
+	case ast.QuantAll:
+		return "not exists (select 1 from " + elements + " where not (" + cond + "))", nil
+	case ast.QuantNone:
+		return "not exists (select 1 from " + elements + " where " + cond + ")", nil
+	default:
+		return "", q.notDefined(string(quantifier), y.Pos())
+	}
+}
+
+// compileLength returns comparison of length of array column, e.g. length(tags)>2
+func (q *Query) compileLength(expr *ast.BinaryExpr, call *ast.CallExpr) (string, error) {
+	if call.Func.Name != "length" {
+		return "", q.notDefined(call.Func.Name, call.Func.Pos())
+	}
+	if len(call.Args) != 1 {
+		return "", q.mustBe(call.Func.Name, "called with 1 argument", "any", call.Pos())
+	}
+	x, ok := call.Args[0].(*ast.Ident)
+	if !ok {
+		return "", q.unexpect(call.Args[0].Token(), call.Args[0].Pos())
+	}
+	column := q.source.Cols.ByName(x.Name)
+	if column == nil {
+		return "", q.notDefined(x.Name, x.Pos())
+	}
+	if !column.IsArray {
+		return "", q.mustBe(x.Name, "array", "any", x.Pos())
+	}
+	switch expr.Op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+	default:
+		return "", q.unexpect(expr.Op, expr.Pos())
+	}
+	y, ok := expr.Y.(*ast.Const)
+	if !ok || y.Token() != token.INT {
+		return "", q.mustBe("length of "+x.Name, "compared with integer", expr.Y.Token().String(), expr.Y.Pos())
+	}
+	var compiledX string
+	var err error
+	switch {
+	case column.Storage == source.StorageTable:
+		compiledX, err = q.compileChildCount(column, x.Pos())
+	case isNative(column):
+		if err = q.checkNative(column, x.Pos()); err == nil {
+			compiledX, err = q.compileIdent(x)
+			compiledX = "cardinality(" + compiledX + ")"
+		}
+	default:
+		compiledX, err = q.compileIdent(x)
+		compiledX = "jsonb_array_length(" + compiledX + "::jsonb)"
+	}
+	if err != nil {
+		return "", err
+	}
+	op, compiledX, compiledY, err := q.compileOperator(expr.Op, compiledX, y.Value, false)
+	if err != nil {
+		return "", err
+	}
+	return compiledX + " " + op + " " + compiledY, nil
+}
+
+// jsonArrayOf returns JSON array literal of compiled values, e.g. '["a", 1]'
+func jsonArrayOf(values []string) string {
+	elements := make([]string, len(values))
+	for i, v := range values {
+		if isQuoted(v) {
+			buf, _ := json.Marshal(strings.Replace(v[1:len(v)-1], "''", "'", -1))
+			v = strings.Replace(string(buf), "'", "''", -1)
+		}
+		elements[i] = v
+	}
+	return "'[" + strings.Join(elements, ", ") + "]'"
+}
@@ -0,0 +1,168 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+// checkAllowed returns error if any column of path like a.b.c is hidden or denies capability
+// itself or for roles of query
+func (q *Query) checkAllowed(cols source.Cols, name string, capability source.Capability, pos token.Pos) error {
+	return q.checkChain(cols.Path(name), name, capability, pos)
+}
+
+// checkChain returns error if any column of chain is hidden or denies capability itself or for roles of query,
+// name is a full name of path like a.b.c
+func (q *Query) checkChain(chain []*source.Col, name string, capability source.Capability, pos token.Pos) error {
+	for _, col := range chain {
+		if col.Hidden {
+			return q.notDefined(name, pos)
+		}
+		if !col.Allows(capability) || !col.AllowsRoles(q.roles, capability) {
+			return fmt.Errorf("%v is not allowed for %v at %v", capability, name, pos)
+		}
+	}
+	return nil
+}
+
+// dropped returns true if field must be silently dropped, because any column of its path
+// denies capability for roles of query and query drops denied fields
+func (q *Query) dropped(cols source.Cols, name string, capability source.Capability) bool {
+	if q.access != DropDenied {
+		return false
+	}
+	for _, col := range cols.Path(name) {
+		if !col.AllowsRoles(q.roles, capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFilterable returns error if condition refers to columns that can not be filtered
+func (q *Query) checkFilterable(expr ast.Expr) error {
+	return q.walkFiltered(expr, func(ident *ast.Ident) error {
+		return q.checkAllowed(q.source.Cols, ident.Name, source.Filterable, ident.Pos())
+	})
+}
+
+// walkFiltered calls fn for every identifier of condition that may refer to column.
+// Conditions of subqueries and sub-filters of objects are skipped, they refer to other columns
+// and are checked while compiled
+func (q *Query) walkFiltered(expr ast.Expr, fn func(ident *ast.Ident) error) error {
+	switch typedExpr := expr.(type) {
+	case *ast.Ident:
+		return fn(typedExpr)
+	case *ast.UnaryExpr:
+		return q.walkFiltered(typedExpr.X, fn)
+	case *ast.BinaryExpr:
+		if err := q.walkFiltered(typedExpr.X, fn); err != nil {
+			return err
+		}
+		if x, ok := typedExpr.X.(*ast.Ident); ok {
+			if column := q.source.Cols.ByName(x.Name); column != nil && column.Type == source.TypeObject {
+				return nil
+			}
+		}
+		return q.walkFiltered(typedExpr.Y, fn)
+	case *ast.QuantifiedExpr:
+		return q.walkFiltered(typedExpr.X, fn)
+	case *ast.ExprList:
+		for _, el := range typedExpr.Exprs {
+			if err := q.walkFiltered(el, fn); err != nil {
+				return err
+			}
+		}
+	case *ast.CallExpr:
+		if typedExpr.Func.Name == "startof" || strings.HasPrefix(typedExpr.Func.Name, "$") {
+			return nil
+		}
+		for _, arg := range typedExpr.Args {
+			if err := q.walkFiltered(arg, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dropDenied returns condition without predicates that refer to columns not filterable for roles
+// of query, operands of and, or, not and groups are dropped separately. Returns nil if nothing is left
+func (q *Query) dropDenied(expr ast.Expr) ast.Expr {
+	switch typedExpr := expr.(type) {
+	case *ast.BinaryExpr:
+		if typedExpr.Op != token.AND && typedExpr.Op != token.OR {
+			break
+		}
+		x, y := q.dropDenied(typedExpr.X), q.dropDenied(typedExpr.Y)
+		switch {
+		case x == nil:
+			return y
+		case y == nil:
+			return x
+		case x == typedExpr.X && y == typedExpr.Y:
+			return expr
+		}
+		return ast.NewBinaryExpr(typedExpr.Op, x, y, typedExpr.Pos())
+	case *ast.UnaryExpr:
+		if typedExpr.Op != token.NOT {
+			break
+		}
+		x := q.dropDenied(typedExpr.X)
+		if x == nil || x == typedExpr.X {
+			return x
+		}
+		return ast.NewUnaryExpr(typedExpr.Op, x, typedExpr.Pos())
+	case *ast.ExprList:
+		exprs := make([]ast.Expr, 0, len(typedExpr.Exprs))
+		for _, el := range typedExpr.Exprs {
+			if x := q.dropDenied(el); x != nil {
+				exprs = append(exprs, x)
+			}
+		}
+		if len(exprs) == 0 {
+			return nil
+		}
+		return ast.NewExprList(typedExpr.Pos(), exprs...)
+	}
+	denied := false
+	q.walkFiltered(expr, func(ident *ast.Ident) error {
+		denied = denied || q.dropped(q.source.Cols, ident.Name, source.Filterable)
+		return nil
+	})
+	if denied {
+		return nil
+	}
+	return expr
+}
+
+// selectableFields returns fields of select * if source has hidden or not selectable (also for roles),
+// computed columns or columns stored in child tables, otherwise returns nil. Fields are sorted by name
+func (q *Query) selectableFields() *ast.IdentList {
+	names := make([]string, 0, len(q.source.Cols))
+	restricted := false
+	for name, col := range q.source.Cols {
+		if col.Allows(source.Selectable) && col.AllowsRoles(q.roles, source.Selectable) {
+			names = append(names, name)
+		} else {
+			restricted = true
+		}
+		if col.Storage == source.StorageTable || col.Expr != "" {
+			restricted = true
+		}
+	}
+	if !restricted {
+		return nil
+	}
+	sort.Strings(names)
+	fields := ast.NewIdentList()
+	for _, name := range names {
+		fields.Append(ast.NewIdent(name, 0))
+	}
+	return fields
+}
@@ -17,18 +17,24 @@ func (q *Query) Compile(target string) (string, error) {
 	}
 
 	var (
-		parts                                          []string
-		selectStmt, whereStmt, orderByStmt, limitsStmt string
-		err                                            error
+		parts                                                 []string
+		selectStmt, joins, whereStmt, orderByStmt, limitsStmt string
+		err                                                   error
 	)
-	selectStmt, err = q.compileSelect()
+	selectStmt, joins, err = q.compileSelect()
 	if err != nil {
 		return "", err
 	}
 	if selectStmt != "" {
 		parts = append(parts, "select", selectStmt)
 	}
-	parts = append(parts, "from", target+" q")
+	parts = append(parts, "from", target+" "+q.tableAlias())
+	if joins != "" {
+		parts = append(parts, joins)
+	}
+	if err := q.checkRequired(); err != nil {
+		return "", err
+	}
 	whereStmt, err = q.compileWhere()
 	if err != nil {
 		return "", err
@@ -53,23 +59,60 @@ func (q *Query) Compile(target string) (string, error) {
 	return strings.Join(parts, " "), nil
 }
 
-func (q *Query) compileSelect() (string, error) {
-	if q.fields == nil || len(*q.fields) == 0 {
-		return "*", nil
-	}
-	fields := make([]string, len(*q.fields))
-	for i, f := range *q.fields {
-		column := q.source.Cols.ByName(f.Name)
-		if column == nil {
-			return "", q.notDefined(f.Name, f.Pos())
+// compileSelect returns fields and lateral joins of embedded fields.
+// Select * is expanded to allowed columns if source has hidden or not selectable columns
+func (q *Query) compileSelect() (string, string, error) {
+	selected := q.fields
+	if selected == nil || len(*selected) == 0 {
+		if selected = q.selectableFields(); selected == nil {
+			return "*", "", nil
+		}
+	}
+	fields := make([]string, 0, len(*selected))
+	var joins []string
+	for _, f := range *selected {
+		if f.Fields == nil && q.dropped(q.source.Cols, f.Name, source.Selectable) {
+			continue
+		}
+		if col := q.source.Cols.ByName(f.Name); col != nil && col.Storage == source.StorageTable && f.Fields == nil {
+			if err := q.checkAllowed(q.source.Cols, f.Name, source.Selectable, f.Pos()); err != nil {
+				return "", "", err
+			}
+			f = q.childFields(f, col)
+		}
+		if f.Fields != nil {
+			compiled, join, err := q.compileEmbedded(f)
+			if err != nil {
+				return "", "", err
+			}
+			fields = append(fields, compiled+` as "`+f.Name+`"`)
+			joins = append(joins, join)
+			continue
 		}
-		fields[i] = "q." + column.DBName
+		if err := q.checkAllowed(q.source.Cols, f.Name, source.Selectable, f.Pos()); err != nil {
+			return "", "", err
+		}
+		compiled, err := q.compileColumnPath(f.Name, f.Pos())
+		if err != nil {
+			return "", "", err
+		}
+		if col := q.source.Cols.ByName(f.Name); strings.Contains(f.Name, ".") || (col != nil && col.Expr != "") {
+			compiled += ` as "` + f.Name + `"`
+		}
+		fields = append(fields, compiled)
+	}
+	if len(fields) == 0 {
+		return "", "", errors.New("no selected fields are allowed")
 	}
-	return strings.Join(fields, ", "), nil
+	return strings.Join(fields, ", "), strings.Join(joins, " "), nil
 }
 
 func (q *Query) compileWhere() (string, error) {
-	if expr := q.Condition(); expr != nil {
+	expr, err := q.whereExpr()
+	if err != nil {
+		return "", err
+	}
+	if expr != nil {
 		compiled, _, err := q.compileExpr(expr)
 		if err != nil {
 			return "", err
@@ -79,6 +122,49 @@ func (q *Query) compileWhere() (string, error) {
 	return "", nil
 }
 
+// filterExpr returns condition without $withDeleted flag and predicates dropped for roles of query,
+// true if soft-deleted rows are included
+func (q *Query) filterExpr() (ast.Expr, bool, error) {
+	expr, withDeleted, err := q.conditionWithDeleted()
+	if err != nil {
+		return nil, false, err
+	}
+	if expr != nil && q.access == DropDenied {
+		expr = q.dropDenied(expr)
+	}
+	return expr, withDeleted, nil
+}
+
+// whereExpr returns checked condition joined with policy and exclusion of soft-deleted rows
+func (q *Query) whereExpr() (ast.Expr, error) {
+	expr, withDeleted, err := q.filterExpr()
+	if err != nil {
+		return nil, err
+	}
+	if expr != nil {
+		if err := q.checkFilterable(expr); err != nil {
+			return nil, err
+		}
+	}
+	mandatory := q.policy
+	// soft-deleted rows of related sources are excluded by compileRelated
+	if deleted := notDeleted(q.source); deleted != nil && !withDeleted && q.parent == nil {
+		if mandatory == nil {
+			mandatory = deleted
+		} else {
+			mandatory = ast.NewBinaryExpr(token.AND, mandatory, deleted, 0)
+		}
+	}
+	if mandatory != nil {
+		if expr == nil {
+			expr = mandatory
+		} else {
+			expr = ast.NewBinaryExpr(token.AND, mandatory, expr, 0)
+		}
+	}
+	return expr, nil
+}
+
 func (q *Query) compileExpr(expr ast.Expr) (string, bool, error) {
 	switch typedExpr := expr.(type) {
 	case *ast.UnaryExpr:
@@ -105,11 +191,28 @@ func (q *Query) compileExpr(expr ast.Expr) (string, bool, error) {
 			return "", false, err
 		}
 		return compiled, false, nil
+	case *ast.CallExpr:
+		compiled, err := q.compileCallExpr(typedExpr)
+		if err != nil {
+			return "", false, err
+		}
+		return compiled, false, nil
 	default:
 		return "", false, errors.New("unexepected expression type")
 	}
 }
 
+func (q *Query) compileCallExpr(expr *ast.CallExpr) (string, error) {
+	switch expr.Func.Name {
+	case "has":
+		return q.compileHas(expr, nil, "")
+	case pseudoExists:
+		return q.compileExists(expr)
+	default:
+		return "", q.notDefined(expr.Func.Name, expr.Func.Pos())
+	}
+}
+
 func (q *Query) compileUnaryExpr(expr *ast.UnaryExpr) (string, error) {
 	var op string
 	switch expr.Op {
@@ -129,21 +232,36 @@ func (q *Query) compileUnaryExpr(expr *ast.UnaryExpr) (string, error) {
 }
 
 func (q *Query) compileBinaryExpr(expr *ast.BinaryExpr) (string, error) {
+	if x, ok := expr.X.(*ast.Ident); ok && expr.Op != token.AND && expr.Op != token.OR {
+		if rel, name := q.relatedField(x.Name); rel != nil {
+			// customer.name="x" is the same as $exists(customer?name="x")
+			field := ast.NewIdent(name, x.Pos()+token.Pos(len(rel.Name)+1))
+			return q.compileExistsRelated(ast.NewIdent(rel.Name, x.Pos()), ast.NewBinaryExpr(expr.Op, field, expr.Y, expr.Pos()))
+		}
+	}
+	if call, ok := expr.X.(*ast.CallExpr); ok && expr.Op.Precedence() == token.EQL.Precedence() {
+		return q.compileLength(expr, call)
+	}
+	if y, ok := expr.Y.(*ast.QuantifiedExpr); ok {
+		x, ok := expr.X.(*ast.Ident)
+		if !ok {
+			return "", q.unexpect(expr.X.Token(), expr.X.Pos())
+		}
+		return q.compileQuantified(expr, x, y)
+	}
 	switch expr.Op {
 	case token.AND, token.OR:
-		x, ok := expr.X.(*ast.BinaryExpr)
-		if !ok {
-			return "", q.unexpect(x.Token(), x.Pos())
+		if !isCondition(expr.X) {
+			return "", q.unexpect(expr.X.Token(), expr.X.Pos())
 		}
-		y, ok := expr.Y.(*ast.BinaryExpr)
-		if !ok {
-			return "", q.unexpect(y.Token(), y.Pos())
+		if !isCondition(expr.Y) {
+			return "", q.unexpect(expr.Y.Token(), expr.Y.Pos())
 		}
-		compiledX, _, err := q.compileExpr(x)
+		compiledX, _, err := q.compileExpr(expr.X)
 		if err != nil {
 			return "", err
 		}
-		compiledY, _, err := q.compileExpr(y)
+		compiledY, _, err := q.compileExpr(expr.Y)
 		if err != nil {
 			return "", err
 		}
@@ -151,14 +269,28 @@ func (q *Query) compileBinaryExpr(expr *ast.BinaryExpr) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		if x.Op.Precedence() < expr.Op.Precedence() {
+		if x, ok := expr.X.(*ast.BinaryExpr); ok && x.Op.Precedence() < expr.Op.Precedence() {
 			compiledX = "(" + compiledX + ")"
 		}
-		if y.Op.Precedence() < expr.Op.Precedence() {
+		if y, ok := expr.Y.(*ast.BinaryExpr); ok && y.Op.Precedence() < expr.Op.Precedence() {
 			compiledY = "(" + compiledY + ")"
 		}
 		return compiledX + " " + op + " " + compiledY, nil
+	case token.MATCH:
+		return q.compileSearch(expr)
 	case token.EQL, token.NEQ:
+		if isSearch(expr) {
+			return q.compileSearch(expr)
+		}
+		if y, ok := expr.Y.(*ast.SubqueryExpr); ok {
+			return q.compileIn(expr, y)
+		}
+		if x, ok := expr.X.(*ast.Ident); ok && isTimeExpr(expr.Y) {
+			return q.compileTimeComparison(expr, x)
+		}
+		if x, ok := expr.X.(*ast.Ident); ok && isNull(expr.Y) && strings.Contains(x.Name, ".") {
+			return q.compileJSONNullIdent(expr.Op, x)
+		}
 		var x, y ast.Expr
 		x, okX := expr.X.(*ast.ExprList)
 		y, okY := expr.Y.(*ast.ExprList)
@@ -183,10 +315,11 @@ func (q *Query) compileBinaryExpr(expr *ast.BinaryExpr) (string, error) {
 		var compiledY string
 		switch y := expr.Y.(type) {
 		case *ast.Const:
-			compiledY, err = q.compileConst(y)
+			compiledY, err = q.compileValue(xCol, y)
 			if err != nil {
 				return "", err
 			}
+			compiledY = q.castValue(xCol, compiledY)
 		case *ast.Ident:
 			compiledY, err = q.compileIdent(y)
 			if err != nil {
@@ -198,53 +331,60 @@ func (q *Query) compileBinaryExpr(expr *ast.BinaryExpr) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		// array=null checks that array itself is null, see compileOperator
+		if isNative(xCol) && !isNull(expr.Y) {
+			return q.compileContains(expr.Op, xCol, compiledX, compiledY, x.Pos())
+		}
 		op, compiledX, compiledY, err := q.compileOperator(expr.Op, compiledX, compiledY, xCol.IsArray)
 		if err != nil {
 			return "", err
 		}
 		return compiledX + " " + op + " " + compiledY, nil
-	case token.LSS, token.LEQ, token.GTR, token.GEQ, token.LIKE:
+	case token.LIKE, token.ILIKE, token.PREFIX, token.SUFFIX, token.IEQL, token.REGEX:
 		x, ok := expr.X.(*ast.Ident)
 		if !ok {
-			return "", q.unexpect(x.Token(), x.Pos())
+			return "", q.unexpect(expr.X.Token(), expr.X.Pos())
+		}
+		column := q.source.Cols.ByName(x.Name)
+		if column == nil {
+			return "", q.notDefined(x.Name, x.Pos())
+		}
+		compiledX, err := q.compileIdent(x)
+		if err != nil {
+			return "", err
+		}
+		return q.compilePattern(expr.Op, column, compiledX, expr.Y)
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		x, ok := expr.X.(*ast.Ident)
+		if !ok {
+			return "", q.unexpect(expr.X.Token(), expr.X.Pos())
+		}
+		if isTimeExpr(expr.Y) {
+			return q.compileTimeComparison(expr, x)
 		}
 		y, ok := expr.Y.(*ast.Const)
 		if !ok {
-			return "", q.unexpect(y.Token(), y.Pos())
+			return "", q.unexpect(expr.Y.Token(), expr.Y.Pos())
 		}
 		colType := q.source.Cols.Type(x.Name)
 		if colType == nil {
 			return "", q.unexpect(x.Token(), x.Pos())
 		}
-		if expr.Op == token.LIKE {
-			if *colType != source.TypeString {
-				return "", q.mustBe(x.Name, "string", "any", x.Pos())
-			}
-			if t := y.Token(); t != token.STRING {
-				return "", q.mustBe(y.Value, "string", t.String(), y.Pos())
-			}
-		} else {
-			switch *colType {
-			case source.TypeNumber:
-				if t := y.Token(); t != token.INT && t != token.FLOAT {
-					return "", q.mustBe(y.Value, "number", t.String(), y.Pos())
-				}
-			case source.TypeTime:
-				if t := y.Token(); t != token.STRING {
-					return "", q.mustBe(y.Value, "time", t.String(), y.Pos())
-				}
-			default:
-				return "", q.mustBe(x.Name, "number or time", "any", x.Pos())
-			}
+		switch *colType {
+		case source.TypeNumber, source.TypeInteger, source.TypeDecimal, source.TypeTime, source.TypeDate, source.TypeInterval:
+		default:
+			return "", q.mustBe(x.Name, "number or time", "any", x.Pos())
 		}
 		compiledX, err := q.compileIdent(x)
 		if err != nil {
 			return "", err
 		}
-		compiledY, err := q.compileConst(y)
+		column := q.source.Cols.ByName(x.Name)
+		compiledY, err := q.compileValue(column, y)
 		if err != nil {
 			return "", err
 		}
+		compiledY = q.castValue(column, compiledY)
 		op, compiledX, compiledY, err := q.compileOperator(expr.Op, compiledX, compiledY, false)
 		if err != nil {
 			return "", err
@@ -275,7 +415,7 @@ func (q *Query) compileBinaryExprWithExprList(x ast.Expr, y *ast.ExprList, op to
 		if err != nil {
 			return "", err
 		}
-		compiledY, err := q.compileExprList(y, column, true)
+		compiledY, err := q.compileExprList(column, y)
 		if err != nil {
 			return "", err
 		}
@@ -289,14 +429,43 @@ func (q *Query) compileBinaryExprWithExprList(x ast.Expr, y *ast.ExprList, op to
 	if column.Type != source.TypeObject {
 		return "", q.mustBe(column.Name, "array of object", "any", x.Pos())
 	}
-	compiledY, err := q.compileExprList(y, column, false)
+	if column.Storage == source.StorageTable {
+		compiled, err := q.compileChildFilter(y, column, "", x.Pos())
+		if err != nil {
+			return "", err
+		}
+		if op == token.NEQ {
+			return "not (" + compiled + ")", nil
+		}
+		return compiled, nil
+	}
+	compiledX, err := q.compileIdent(typedX)
 	if err != nil {
 		return "", err
 	}
+	var compiled string
 	if column.IsArray {
-		return "exists (select 1 from (select jsonb_array_elements(q." + column.DBName + "::jsonb) item) j where " + compiledY + ")", nil
+		compiled, err = q.compileArrayOfObjectFilter(y, column, compiledX+"::jsonb", "", 0)
+	} else {
+		compiled, err = q.compileObjectFilter(y, column, compiledX, 0)
+	}
+	if err != nil {
+		return "", err
+	}
+	if op == token.NEQ {
+		return "not (" + compiled + ")", nil
+	}
+	return compiled, nil
+}
+
+// isCondition returns true if expression may be an operand of AND and OR
+func isCondition(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.BinaryExpr, *ast.UnaryExpr, *ast.CallExpr:
+		return true
+	default:
+		return false
 	}
-	return compiledY, nil
 }
 
 func isExprArray(expr *ast.ExprList) bool {
@@ -307,162 +476,43 @@ func isExprArray(expr *ast.ExprList) bool {
 	return isArray
 }
 
-func (q *Query) compileExprList(expr *ast.ExprList, column *source.Col, isArray bool) (string, error) {
+// compileExprList returns list of values compatible with column datatype
+func (q *Query) compileExprList(column *source.Col, expr *ast.ExprList) (string, error) {
 	if expr == nil || len(expr.Exprs) == 0 {
 		return "", errors.New("unexpected empty expression list")
 	}
 	var compiled []string
 	for _, el := range expr.Exprs {
-		switch typedEl := el.(type) {
-		case *ast.Const:
-			if !isArray {
-				return "", q.unexpect(typedEl.Token(), typedEl.Pos())
-			}
-			compiledConst, err := q.compileConst(typedEl)
-			if err != nil {
-				return "", err
-			}
-			compiled = append(compiled, compiledConst)
-		case *ast.UnaryExpr:
-			if !isArray {
-				return "", q.unexpect(typedEl.Op, typedEl.Pos())
-			}
-			compiledExpr, err := q.compileUnaryExpr(typedEl)
-			if err != nil {
-				return "", err
-			}
-			compiled = append(compiled, compiledExpr)
-		case *ast.BinaryExpr:
-			var compiledExpr string
-			var err error
-			if column.IsArray {
-				compiledExpr, err = q.compileArrayOfObject(typedEl, column)
-			} else {
-				compiledExpr, err = q.compileObject(typedEl, column)
-			}
-			if err != nil {
-				return "", err
-			}
-			compiled = append(compiled, compiledExpr)
-		default:
-			return "", q.unexpect(typedEl.Token(), typedEl.Pos())
-		}
-	}
-
-	if isArray {
-		return "(" + strings.Join(compiled, ", ") + ")", nil
-	}
-	return strings.Join(compiled, " and "), nil
-}
-
-func (q *Query) compileArrayOfObject(expr *ast.BinaryExpr, column *source.Col) (string, error) {
-	ident, ok := expr.X.(*ast.Ident)
-	if !ok {
-		return "", q.unexpect(expr.X.Token(), expr.X.Pos())
-	}
-	name := column.Name + "." + ident.Name
-	t := q.source.Cols.Type(name)
-	if t == nil {
-		return "", q.notDefined(name, ident.Pos())
-	}
-	var typeCast string
-	switch *t {
-	case source.TypeBool:
-		typeCast = "boolean"
-	case source.TypeNumber:
-		typeCast = "numeric"
-	case source.TypeString:
-		typeCast = "text"
-	case source.TypeTime:
-		typeCast = "timestamp"
-	default:
-		return "", q.mustBe(name, "boolean/numeric/text/timestamp", "any", ident.Pos())
-	}
-	path, ok := q.source.Cols.JSONPath(name)
-	if !ok {
-		return "", q.notDefined(name, ident.Pos())
-	}
-	var compiledY string
-	yConst, ok := expr.Y.(*ast.Const)
-	needTypeCast := ok
-	if !ok {
-		yIdent, ok := expr.Y.(*ast.Ident)
-		if !ok {
-			return "", q.unexpect(expr.Y.Token(), expr.Y.Pos())
-		}
-		if yIdent.Name != "null" && yIdent.Name != "true" && yIdent.Name != "false" {
-			return "", q.unexpect(expr.Y.Token(), expr.Y.Pos())
-		}
-		compiledY = yIdent.Name
-	} else {
-		var err error
-		compiledY, err = q.compileConst(yConst)
+		compiledValue, err := q.compileValue(column, el)
 		if err != nil {
 			return "", err
 		}
+		compiled = append(compiled, q.castValue(column, compiledValue))
 	}
-
-	op, _, compiledY, err := q.compileOperator(expr.Op, "", compiledY, false)
-	if err != nil {
-		return "", err
-	}
-	if needTypeCast {
-		return "(j.item #>> '{" + path + "}')::" + typeCast + " " + op + " " + compiledY + "::" + typeCast, nil
-	}
-	return "(j.item #>> '{" + path + "}')::" + typeCast + " " + op + " " + compiledY, nil
+	return "(" + strings.Join(compiled, ", ") + ")", nil
 }
 
-func (q *Query) compileObject(expr *ast.BinaryExpr, column *source.Col) (string, error) {
-	ident, ok := expr.X.(*ast.Ident)
-	if !ok {
-		return "", q.unexpect(expr.X.Token(), expr.X.Pos())
-	}
-	name := column.Name + "." + ident.Name
-	t := q.source.Cols.Type(name)
-	if t == nil {
-		return "", q.notDefined(name, ident.Pos())
+// compilePattern returns string matching of compiled x with string constant y
+func (q *Query) compilePattern(op token.Token, column *source.Col, x string, y ast.Expr) (string, error) {
+	if column.Type != source.TypeString {
+		return "", q.mustBe(column.Name, "string", "any", y.Pos())
 	}
-	var typeCast string
-	switch *t {
-	case source.TypeBool:
-		typeCast = "boolean"
-	case source.TypeNumber:
-		typeCast = "numeric"
-	case source.TypeString:
-		typeCast = "text"
-	case source.TypeTime:
-		typeCast = "timestamp"
-	default:
-		return "", q.mustBe(name, "boolean/numeric/text/timestamp", "any", ident.Pos())
+	if op == token.REGEX && !column.Regex {
+		return "", fmt.Errorf("regular expressions are not allowed for %v at %v", column.Name, y.Pos())
 	}
-	path, ok := q.source.Cols.JSONPath(name)
-	if !ok {
-		return "", q.notDefined(name, ident.Pos())
+	yConst, ok := y.(*ast.Const)
+	if !ok || yConst.Token() != token.STRING {
+		return "", q.mustBe(op.String()+" operand", "string", y.Token().String(), y.Pos())
 	}
-	var compiledY string
-	yConst, ok := expr.Y.(*ast.Const)
-	if !ok {
-		yIdent, ok := expr.Y.(*ast.Ident)
-		if !ok {
-			return "", q.unexpect(expr.Y.Token(), expr.Y.Pos())
-		}
-		if yIdent.Name != "null" && yIdent.Name != "true" && yIdent.Name != "false" {
-			return "", q.unexpect(expr.Y.Token(), expr.Y.Pos())
-		}
-		compiledY = yIdent.Name
-	} else {
-		var err error
-		compiledY, err = q.compileConst(yConst)
-		if err != nil {
-			return "", err
-		}
+	compiledY, err := q.compileConst(yConst)
+	if err != nil {
+		return "", err
 	}
-
-	op, _, compiledY, err := q.compileOperator(expr.Op, "", compiledY, false)
+	compiledOp, x, compiledY, err := q.compileOperator(op, x, compiledY, false)
 	if err != nil {
 		return "", err
 	}
-	return "(q." + column.DBName + " #>> '{" + path + "}')::" + typeCast + " " + op + " " + compiledY + "::" + typeCast, nil
+	return x + " " + compiledOp + " " + compiledY, nil
 }
 
 func (q *Query) compileIdent(expr *ast.Ident) (string, error) {
@@ -470,11 +520,7 @@ func (q *Query) compileIdent(expr *ast.Ident) (string, error) {
 	case "true", "false", "null":
 		return expr.Name, nil
 	default:
-		column := q.source.Cols.ByName(expr.Name)
-		if column == nil {
-			return "", q.notDefined(expr.Name, expr.Pos())
-		}
-		return "q." + column.DBName, nil
+		return q.compileColumnPath(expr.Name, expr.Pos())
 	}
 }
 
@@ -483,7 +529,54 @@ func (q *Query) compileConst(expr *ast.Const) (string, error) {
 	case token.INT, token.FLOAT:
 		return expr.Value, nil
 	case token.STRING:
-		return "'" + expr.Value + "'", nil
+		return "'" + strings.Replace(expr.Value, "'", "''", -1) + "'", nil
+	default:
+		return "", q.unexpect(expr.Token(), expr.Pos())
+	}
+}
+
+// compileValue returns constant that must be compatible with column datatype
+func (q *Query) compileValue(column *source.Col, expr ast.Expr) (string, error) {
+	switch typedExpr := expr.(type) {
+	case *ast.Const:
+		t := typedExpr.Token()
+		switch column.Type {
+		case source.TypeNumber:
+			if t != token.INT && t != token.FLOAT {
+				return "", q.mustBe(typedExpr.Value, "number", t.String(), typedExpr.Pos())
+			}
+		case source.TypeString:
+			if t != token.STRING {
+				return "", q.mustBe(typedExpr.Value, "string", t.String(), typedExpr.Pos())
+			}
+		case source.TypeTime:
+			if t != token.STRING {
+				return "", q.mustBe(typedExpr.Value, "time", t.String(), typedExpr.Pos())
+			}
+		case source.TypeInteger, source.TypeDecimal, source.TypeDate, source.TypeUUID,
+			source.TypeEnum, source.TypeInterval, source.TypeJSON:
+			return q.compileTypedConst(column, typedExpr)
+		default:
+			return "", q.mustBe(typedExpr.Value, column.Name+" value", t.String(), typedExpr.Pos())
+		}
+		return q.compileConst(typedExpr)
+	case *ast.UnaryExpr:
+		if typedExpr.Op != token.MINUS {
+			return "", q.unexpect(typedExpr.Op, typedExpr.Pos())
+		}
+		compiled, err := q.compileValue(column, typedExpr.X)
+		if err != nil {
+			return "", err
+		}
+		if !isNumeric(column.Type) {
+			return "", q.mustBe(column.Name, "number", "any", typedExpr.Pos())
+		}
+		return "-" + compiled, nil
+	case *ast.Ident:
+		if column.Type != source.TypeBool || (typedExpr.Name != "true" && typedExpr.Name != "false") {
+			return "", q.unexpect(typedExpr.Token(), typedExpr.Pos())
+		}
+		return typedExpr.Name, nil
 	default:
 		return "", q.unexpect(expr.Token(), expr.Pos())
 	}
@@ -496,25 +589,25 @@ func (q *Query) compileOperator(op token.Token, x, y string, isArray bool) (stri
 	case token.OR:
 		return "or", x, y, nil
 	case token.EQL:
+		if y == "null" {
+			return "is", x, y, nil
+		}
 		if isArray {
 			if strings.HasPrefix(y, "'") && strings.HasSuffix(y, "'") {
 				return "@>", x, `'"` + y[1:len(y)-1] + `"'`, nil
 			}
 			return "@>", x, "'" + y + "'", nil
 		}
-		if y == "null" {
-			return "is", x, y, nil
-		}
 		return "=", x, y, nil
 	case token.NEQ:
+		if y == "null" {
+			return "is not", x, y, nil
+		}
 		if isArray {
 			if strings.HasPrefix(y, "'") && strings.HasSuffix(y, "'") {
-				return "@>", "not" + x, `'"` + y[1:len(y)-1] + `"'`, nil
+				return "@>", "not " + x, `'"` + y[1:len(y)-1] + `"'`, nil
 			}
-			return "@>", "not" + x, "'" + y + "'", nil
-		}
-		if y == "null" {
-			return "is not", x, y, nil
+			return "@>", "not " + x, "'" + y + "'", nil
 		}
 		return "!=", x, y, nil
 	case token.LSS:
@@ -525,39 +618,101 @@ func (q *Query) compileOperator(op token.Token, x, y string, isArray bool) (stri
 		return ">", x, y, nil
 	case token.GEQ:
 		return ">=", x, y, nil
-	case token.LIKE:
-		if !strings.HasPrefix(y, "'") || strings.HasSuffix(y, "'") {
-			return "", "", "", fmt.Errorf("like can only be used with strings")
+	case token.LIKE, token.ILIKE, token.PREFIX, token.SUFFIX:
+		if !isQuoted(y) {
+			return "", "", "", fmt.Errorf("%v can only be used with strings", op)
+		}
+		pattern := likeEscaper.Replace(y[1 : len(y)-1])
+		switch op {
+		case token.PREFIX:
+			pattern = pattern + "%"
+		case token.SUFFIX:
+			pattern = "%" + pattern
+		default:
+			pattern = "%" + pattern + "%"
+		}
+		compiledOp := "like"
+		if op == token.ILIKE && q.dialect != SQLite {
+			compiledOp = "ilike"
+		}
+		if q.dialect == SQLite {
+			return compiledOp, x, "'" + pattern + "' escape '\\'", nil
 		}
-		return "like", x, "'%" + y[1:len(y)-1] + "%'", nil
+		return compiledOp, x, "'" + pattern + "'", nil
+	case token.IEQL:
+		return "=", "lower(" + x + ")", "lower(" + y + ")", nil
+	case token.REGEX:
+		if !isQuoted(y) {
+			return "", "", "", fmt.Errorf("%v can only be used with strings", op)
+		}
+		if q.dialect == SQLite {
+			return "regexp", x, y, nil
+		}
+		return "~", x, y, nil
 	default:
 		return "", "", "", fmt.Errorf("%v is not operator", op)
 	}
 }
 
+// likeEscaper escapes wildcards of like patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// isQuoted returns true if compiled value is a string literal
+func isQuoted(s string) bool {
+	return len(s) > 1 && strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'")
+}
+
 func (q *Query) compileOrderBy() (string, error) {
 	if q.orderBy == nil || len(*q.orderBy) == 0 {
 		return "", nil
 	}
-	orderBy := make([]string, len(*q.orderBy))
-	for i, f := range *q.orderBy {
+	orderBy := make([]string, 0, len(*q.orderBy))
+	for _, f := range *q.orderBy {
+		if f.Field.Name == pseudoRank {
+			compiled, err := q.compileRank(f.Field)
+			if err != nil {
+				return "", err
+			}
+			orderBy = append(orderBy, compiled+" "+string(f.Direction.Value))
+			continue
+		}
+		if rel, name := q.relatedField(f.Field.Name); rel != nil {
+			if q.dropped(rel.Source.Cols, name, source.Sortable) {
+				continue
+			}
+			if err := q.checkAllowed(rel.Source.Cols, name, source.Sortable, f.Field.Pos()); err != nil {
+				return "", err
+			}
+			compiled, err := q.compileRelatedValue(rel, ast.NewIdent(name, f.Field.Pos()+token.Pos(len(rel.Name)+1)))
+			if err != nil {
+				return "", err
+			}
+			orderBy = append(orderBy, compiled+" "+string(f.Direction.Value))
+			continue
+		}
+		if q.dropped(q.source.Cols, f.Field.Name, source.Sortable) {
+			continue
+		}
 		var compiled string
 		column := q.source.Cols.ByName(f.Field.Name)
 		if column == nil {
 			return "", q.notDefined(f.Field.Name, f.Field.Pos())
 		}
-		path, ok := q.source.Cols.JSONPath(f.Field.Name)
-		if ok {
-			parts := strings.Split(f.Field.Name, ".")
-			mainColumn := q.source.Cols.ByName(parts[0])
-			if mainColumn == nil {
-				return "", q.notDefined(parts[0], f.Field.Pos())
+		if err := q.checkAllowed(q.source.Cols, f.Field.Name, source.Sortable, f.Field.Pos()); err != nil {
+			return "", err
+		}
+		if strings.Contains(f.Field.Name, ".") {
+			var err error
+			compiled, err = q.compileColumnPath(f.Field.Name, f.Field.Pos())
+			if err != nil {
+				return "", err
 			}
-			compiled = "(" + mainColumn.DBName + " #>> '{" + path + "}')::" + q.compileType(column.Type)
+		} else if column.Expr != "" {
+			compiled = q.compileColumn(column)
 		} else {
 			compiled = column.DBName
 		}
-		orderBy[i] = compiled + " " + string(f.Direction.Value)
+		orderBy = append(orderBy, compiled+" "+string(f.Direction.Value))
 	}
 	return strings.Join(orderBy, ", "), nil
 }
@@ -601,6 +756,18 @@ func (q *Query) compileType(t source.Datatype) string {
 		return "text"
 	case source.TypeTime:
 		return "timestamp"
+	case source.TypeInteger:
+		return "bigint"
+	case source.TypeDecimal:
+		return "numeric"
+	case source.TypeDate:
+		return "date"
+	case source.TypeUUID:
+		return "uuid"
+	case source.TypeInterval:
+		return "interval"
+	case source.TypeJSON:
+		return "jsonb"
 	default:
 		return "text"
 	}
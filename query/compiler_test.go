@@ -1,7 +1,9 @@
 package query
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/x-foby/w3sql/ast"
 	"github.com/x-foby/w3sql/source"
@@ -110,7 +112,7 @@ var cases = []struct {
 				),
 			},
 		},
-		Result: "select * from table q order by (a #>> '{b}')::numeric asc",
+		Result: "select * from table q order by (q.a #>> '{b}')::numeric asc",
 	},
 	{
 		Name:   "Simple",
@@ -250,7 +252,7 @@ var cases = []struct {
 				),
 			},
 		},
-		Result: `select q.a, q.b from table q where exists (select 1 from (select jsonb_array_elements(q.a::jsonb) item) j where (j.item #>> '{b}')::text is null)`,
+		Result: `select q.a, q.b from table q where exists (select 1 from (select jsonb_array_elements(q.a::jsonb) item) j where j.item #> '{b}' = 'null'::jsonb)`,
 	},
 	{
 		Name:   "Simple",
@@ -310,7 +312,102 @@ var cases = []struct {
 				),
 			},
 		},
-		Result: `select q.a, q.b from table q where exists (select 1 from (select jsonb_array_elements(q.a::jsonb) item) j where (j.item #>> '{b}')::text = 'b'::text and (j.item #>> '{c,d}')::numeric = 4::numeric) and q.b @> '"a"'`,
+		Result: `select q.a, q.b from table q where exists (select 1 from (select jsonb_array_elements(q.a::jsonb) item) j where (j.item #>> '{b}')::text = 'b'::text and exists (select 1 from (select jsonb_array_elements(j.item #> '{c}') item) j2 where (j2.item #>> '{d}')::numeric = 4::numeric)) and q.b @> '"a"'`,
+	},
+	{
+		Name:   "Nested object and array of object",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.EQL,
+					ast.NewIdent("a", 1),
+					ast.NewExprList(3, ast.NewBinaryExpr(
+						token.EQL,
+						ast.NewIdent("o", 4),
+						ast.NewExprList(6, ast.NewBinaryExpr(token.GTR, ast.NewIdent("x", 7), ast.NewConst("1", 9, token.INT), 8)),
+						5,
+					)),
+					2,
+				),
+				ast.NewBinaryExpr(
+					token.NEQ,
+					ast.NewIdent("b", 14),
+					ast.NewExprList(17, ast.NewBinaryExpr(
+						token.EQL,
+						ast.NewIdent("c", 18),
+						ast.NewExprList(20, ast.NewBinaryExpr(token.EQL, ast.NewIdent("d", 21), ast.NewConst("4", 23, token.INT), 22)),
+						19,
+					)),
+					15,
+				),
+				12,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeObject, "a", "a", false).WithChildren(source.NewCols(
+						source.NewCol(source.TypeObject, "o", "o", false).WithChildren(source.NewCols(
+							source.NewCol(source.TypeNumber, "x", "x", false),
+						)),
+					)),
+					source.NewCol(source.TypeObject, "b", "b", true).WithChildren(source.NewCols(
+						source.NewCol(source.TypeObject, "c", "c", true).WithChildren(source.NewCols(
+							source.NewCol(source.TypeNumber, "d", "d", false),
+						)),
+					)),
+				),
+			},
+		},
+		Result: `select * from table q where ((q.a::jsonb #> '{o}') #>> '{x}')::numeric > 1::numeric and not (exists (select 1 from (select jsonb_array_elements(q.b::jsonb) item) j where exists (select 1 from (select jsonb_array_elements(j.item #> '{c}') item) j2 where (j2.item #>> '{d}')::numeric = 4::numeric)))`,
+	},
+	{
+		Name:   "Quantified array of object",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.EQL,
+					ast.NewIdent("a", 1),
+					ast.NewQuantifiedExpr(ast.QuantAny, ast.NewExprList(7,
+						ast.NewBinaryExpr(token.EQL, ast.NewIdent("x", 8), ast.NewConst("1", 10, token.INT), 9),
+						ast.NewBinaryExpr(token.EQL, ast.NewIdent("y", 12), ast.NewConst("2", 14, token.INT), 13),
+					), 3),
+					2,
+				),
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewBinaryExpr(
+						token.EQL,
+						ast.NewIdent("a", 17),
+						ast.NewQuantifiedExpr(ast.QuantAll, ast.NewExprList(23,
+							ast.NewBinaryExpr(token.GTR, ast.NewIdent("x", 24), ast.NewConst("0", 26, token.INT), 25),
+						), 19),
+						18,
+					),
+					ast.NewBinaryExpr(
+						token.EQL,
+						ast.NewIdent("a", 29),
+						ast.NewQuantifiedExpr(ast.QuantNone, ast.NewExprList(36,
+							ast.NewBinaryExpr(token.EQL, ast.NewIdent("y", 37), ast.NewConst("3", 39, token.INT), 38),
+						), 31),
+						30,
+					),
+					28,
+				),
+				16,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeObject, "a", "a", true).WithChildren(source.NewCols(
+						source.NewCol(source.TypeNumber, "x", "x", false),
+						source.NewCol(source.TypeNumber, "y", "y", false),
+					)),
+				),
+			},
+		},
+		Result: `select * from table q where exists (select 1 from (select jsonb_array_elements(q.a::jsonb) item) j where (j.item #>> '{x}')::numeric = 1::numeric) and exists (select 1 from (select jsonb_array_elements(q.a::jsonb) item) j where (j.item #>> '{y}')::numeric = 2::numeric) and not exists (select 1 from (select jsonb_array_elements(q.a::jsonb) item) j where ((j.item #>> '{x}')::numeric > 0::numeric) is not true) and not exists (select 1 from (select jsonb_array_elements(q.a::jsonb) item) j where (j.item #>> '{y}')::numeric = 3::numeric)`,
 	},
 	{
 		Name:   "Simple",
@@ -393,19 +490,2454 @@ var cases = []struct {
 		},
 		Result: `select * from table q where (q.a = 'a' or q.a = 'b' or q.a = 'c') and q.b = 'a'`,
 	},
-}
-
-func TestCompile(t *testing.T) {
-	for _, c := range cases {
-		t.Run(c.Name, func(t *testing.T) {
-			sql, err := c.Query.Compile(c.Target)
-			if err != nil {
-				t.Errorf("expected err: %v, got: %v", nil, err)
-				t.FailNow()
-			}
-
-			if sql != c.Result {
-				t.Errorf("expected: %v, got: %v", c.Result, sql)
+	{
+		Name:   "Relative time",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.GTR,
+					ast.NewIdent("a", 5),
+					ast.NewBinaryExpr(token.MINUS, ast.NewIdent("now", 7), ast.NewConst("7d", 11, token.INTERVAL), 10),
+					6,
+				),
+				ast.NewBinaryExpr(
+					token.LSS,
+					ast.NewIdent("b", 15),
+					ast.NewBinaryExpr(
+						token.PLUS,
+						ast.NewCallExpr(ast.NewIdent("startof", 17), 17, ast.NewIdent("month", 25)),
+						ast.NewConst("1M", 32, token.INTERVAL),
+						31,
+					),
+					16,
+				),
+				14,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeTime, "a", "a", false),
+					source.NewCol(source.TypeTime, "b", "b", false),
+				),
+			},
+			clock: testClock,
+		},
+		Result: "select * from table q where q.a > '2020-05-17 10:30:00Z'::timestamptz - interval '7 days' and q.b < date_trunc('month', '2020-05-17 10:30:00Z'::timestamptz, 'UTC') + interval '1 months'",
+	},
+	{
+		Name:   "Relative time in sqlite",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.GEQ,
+					ast.NewIdent("a", 5),
+					ast.NewBinaryExpr(token.MINUS, ast.NewIdent("now", 7), ast.NewConst("2w", 11, token.INTERVAL), 10),
+					6,
+				),
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("b", 15), ast.NewCallExpr(ast.NewIdent("startof", 17), 17, ast.NewIdent("day", 25)), 16),
+				14,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeTime, "a", "a", false),
+					source.NewCol(source.TypeTime, "b", "b", false),
+				),
+			},
+			dialect: SQLite,
+			clock:   testClock,
+		},
+		Result: "select * from table q where q.a >= datetime(datetime('2020-05-17 10:30:00'), '-14 days') and q.b = datetime(datetime('2020-05-17 10:30:00'), 'start of day')",
+	},
+	{
+		Name:   "Relative time of date column",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.GEQ, ast.NewIdent("d", 1), ast.NewBinaryExpr(token.MINUS, ast.NewIdent("now", 4), ast.NewConst("1d", 8, token.INTERVAL), 7), 2),
+				ast.NewBinaryExpr(token.LSS, ast.NewIdent("d", 11), ast.NewCallExpr(ast.NewIdent("startof", 13), 13, ast.NewIdent("month", 21)), 12),
+				10,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeDate, "d", "d", false)),
+			},
+			clock: testClock,
+		},
+		Result: "select * from table q where q.d >= (('2020-05-17 10:30:00Z'::timestamptz - interval '1 days') at time zone 'UTC')::date " +
+			"and q.d < ((date_trunc('month', '2020-05-17 10:30:00Z'::timestamptz, 'UTC')) at time zone 'UTC')::date",
+	},
+	{
+		Name:   "Relative time of date column in sqlite",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.GEQ, ast.NewIdent("d", 1), ast.NewBinaryExpr(token.MINUS, ast.NewIdent("now", 4), ast.NewConst("1d", 8, token.INTERVAL), 7), 2),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeDate, "d", "d", false)),
+			},
+			dialect: SQLite,
+			clock:   testClock,
+		},
+		Result: "select * from table q where q.d >= date(datetime(datetime('2020-05-17 10:30:00'), '-1 days'))",
+	},
+	{
+		Name:   "Relative time of clock in other zone",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.GTR, ast.NewIdent("a", 1), ast.NewIdent("now", 3), 2),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeTime, "a", "a", false)),
+			},
+			clock: func() time.Time {
+				return testClock().In(time.FixedZone("UTC+3", 3*60*60))
+			},
+		},
+		Result: "select * from table q where q.a > '2020-05-17 10:30:00Z'::timestamptz",
+	},
+	{
+		Name:   "JSON null and existence",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("a.b", 1), ast.NewIdent("null", 5), 4),
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewUnaryExpr(token.NOT, ast.NewCallExpr(ast.NewIdent("has", 11), 11, ast.NewIdent("a.c", 15)), 10),
+					ast.NewBinaryExpr(
+						token.OR,
+						ast.NewCallExpr(ast.NewIdent("has", 20), 20, ast.NewIdent("a.c.d", 24)),
+						ast.NewCallExpr(ast.NewIdent("has", 31), 31, ast.NewIdent("b", 35)),
+						30,
+					),
+					19,
+				),
+				9,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeObject, "a", "a", false).WithChildren(source.NewCols(
+						source.NewCol(source.TypeString, "b", "b", false),
+						source.NewCol(source.TypeObject, "c", "c", true).WithChildren(source.NewCols(
+							source.NewCol(source.TypeNumber, "d", "d", false),
+						)),
+					)),
+					source.NewCol(source.TypeString, "b", "b", false),
+				),
+			},
+		},
+		Result: `select * from table q where q.a::jsonb #> '{b}' = 'null'::jsonb and not q.a::jsonb ? 'c' and (jsonb_path_exists(q.a::jsonb, '$.c[*].d') or q.b is not null)`,
+	},
+	{
+		Name:   "Raw JSON null and existence",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewCallExpr(ast.NewIdent("has", 1), 1, ast.NewIdent("meta.tags", 5)),
+					ast.NewBinaryExpr(token.EQL, ast.NewIdent("meta.tags", 16), ast.NewIdent("null", 26), 25),
+					15,
+				),
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewCallExpr(ast.NewIdent("has", 32), 32, ast.NewIdent("meta.a.b", 36)),
+					ast.NewBinaryExpr(token.NEQ, ast.NewIdent("meta.a.b", 46), ast.NewIdent("null", 56), 54),
+					45,
+				),
+				31,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeJSON, "meta", "meta", false)),
+			},
+		},
+		Result: `select * from table q where q.meta::jsonb ? 'tags' and q.meta::jsonb #> '{tags}' = 'null'::jsonb and ` +
+			`jsonb_path_exists(q.meta::jsonb, '$.a.b') and q.meta::jsonb #> '{a,b}' != 'null'::jsonb`,
+	},
+	{
+		Name:   "JSON null and existence in array of object",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.EQL,
+					ast.NewIdent("a", 1),
+					ast.NewExprList(3,
+						ast.NewCallExpr(ast.NewIdent("has", 4), 4, ast.NewIdent("b", 8)),
+						ast.NewUnaryExpr(token.NOT, ast.NewCallExpr(ast.NewIdent("has", 12), 12, ast.NewIdent("c", 16)), 11),
+					),
+					2,
+				),
+				ast.NewBinaryExpr(token.NEQ, ast.NewIdent("a.c", 22), ast.NewIdent("null", 27), 25),
+				20,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeObject, "a", "a", true).WithChildren(source.NewCols(
+						source.NewCol(source.TypeString, "b", "b", false),
+						source.NewCol(source.TypeObject, "c", "c", false),
+					)),
+				),
+			},
+		},
+		Result: `select * from table q where exists (select 1 from (select jsonb_array_elements(q.a::jsonb) item) j where j.item ? 'b' and not j.item ? 'c') and jsonb_path_exists(q.a::jsonb, '$[*].c ? (@ != null)')`,
+	},
+	{
+		Name:   "String matching",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.LIKE, ast.NewIdent("a", 1), ast.NewConst("50%_off", 4, token.STRING), 2),
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewBinaryExpr(token.ILIKE, ast.NewIdent("a", 15), ast.NewConst("x", 19, token.STRING), 16),
+					ast.NewBinaryExpr(
+						token.AND,
+						ast.NewBinaryExpr(token.PREFIX, ast.NewIdent("a", 24), ast.NewConst("it's", 27, token.STRING), 25),
+						ast.NewBinaryExpr(
+							token.AND,
+							ast.NewBinaryExpr(token.SUFFIX, ast.NewIdent("a", 35), ast.NewConst(`\`, 38, token.STRING), 36),
+							ast.NewBinaryExpr(
+								token.AND,
+								ast.NewBinaryExpr(token.IEQL, ast.NewIdent("a", 44), ast.NewConst("X", 47, token.STRING), 45),
+								ast.NewBinaryExpr(token.REGEX, ast.NewIdent("b", 52), ast.NewConst("^[a-z]+$", 55, token.STRING), 53),
+								51,
+							),
+							43,
+						),
+						34,
+					),
+					23,
+				),
+				14,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeString, "a", "a", false),
+					source.NewCol(source.TypeString, "b", "b", false).WithRegex(),
+				),
+			},
+		},
+		Result: `select * from table q where q.a like '%50\%\_off%' and q.a ilike '%x%' and q.a like 'it''s%' and q.a like '%\\' and lower(q.a) = lower('X') and q.b ~ '^[a-z]+$'`,
+	},
+	{
+		Name:   "String matching in sub-filters",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.EQL,
+					ast.NewIdent("a", 1),
+					ast.NewExprList(3, ast.NewBinaryExpr(token.PREFIX, ast.NewIdent("b", 4), ast.NewConst("x", 7, token.STRING), 5)),
+					2,
+				),
+				ast.NewBinaryExpr(
+					token.EQL,
+					ast.NewIdent("o", 12),
+					ast.NewExprList(14, ast.NewBinaryExpr(token.IEQL, ast.NewIdent("b", 15), ast.NewConst("X", 18, token.STRING), 16)),
+					13,
+				),
+				11,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeObject, "a", "a", true).WithChildren(source.NewCols(
+						source.NewCol(source.TypeString, "b", "b", false),
+					)),
+					source.NewCol(source.TypeObject, "o", "o", false).WithChildren(source.NewCols(
+						source.NewCol(source.TypeString, "b", "b", false),
+					)),
+				),
+			},
+		},
+		Result: `select * from table q where exists (select 1 from (select jsonb_array_elements(q.a::jsonb) item) j where (j.item #>> '{b}')::text like 'x%') and lower((q.o #>> '{b}')::text) = lower('X')`,
+	},
+	{
+		Name:   "String matching in sqlite",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.ILIKE, ast.NewIdent("a", 1), ast.NewConst("x_", 4, token.STRING), 2),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeString, "a", "a", false)),
+			},
+			dialect: SQLite,
+		},
+		Result: `select * from table q where q.a like '%x\_%' escape '\'`,
+	},
+	{
+		Name:   "Full-text search",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.MATCH, ast.NewIdent("a", 1), ast.NewConst("fast & cheap", 4, token.STRING), 2),
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("$search", 20), ast.NewConst("cheap", 28, token.STRING), 27),
+				19,
+			),
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("$rank", 37), ast.NewOrderByDir(ast.OrderDesc, 36, token.MINUS)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeString, "a", "a", false),
+					source.NewCol(source.TypeString, "b", "b", false),
+				),
+				Search: &source.Search{Config: "english", Cols: []string{"a", "b"}},
+			},
+		},
+		Result: `select * from table q where to_tsvector('english', q.a) @@ websearch_to_tsquery('english', 'fast & cheap') and to_tsvector('english', coalesce(q.a, '') || ' ' || coalesce(q.b, '')) @@ websearch_to_tsquery('english', 'cheap') order by ts_rank(to_tsvector('english', q.a), websearch_to_tsquery('english', 'fast & cheap')) desc`,
+	},
+	{
+		Name:   "Full-text search with tsvector column",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.MATCH, ast.NewIdent("$search", 1), ast.NewConst("cheap", 10, token.STRING), 8),
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("$rank", 18), ast.NewOrderByDir(ast.OrderDesc, 17, token.MINUS)),
+			),
+			source: &source.Source{
+				Cols:   source.NewCols(source.NewCol(source.TypeString, "a", "a", false)),
+				Search: &source.Search{Vector: "search_vector"},
+			},
+		},
+		Result: `select * from table q where q.search_vector @@ websearch_to_tsquery('simple', 'cheap') order by ts_rank(q.search_vector, websearch_to_tsquery('simple', 'cheap')) desc`,
+	},
+	{
+		Name:   "Array predicates",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.EQL,
+					ast.NewIdent("tags", 1),
+					ast.NewQuantifiedExpr(ast.QuantAll, ast.NewExprList(9, ast.NewConst("a", 10, token.STRING), ast.NewConst("it's", 14, token.STRING)), 6),
+					5,
+				),
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewBinaryExpr(
+						token.NEQ,
+						ast.NewIdent("tags", 22),
+						ast.NewQuantifiedExpr(ast.QuantAny, ast.NewExprList(31, ast.NewConst("c", 32, token.STRING)), 28),
+						26,
+					),
+					ast.NewBinaryExpr(
+						token.AND,
+						ast.NewBinaryExpr(
+							token.GTR,
+							ast.NewCallExpr(ast.NewIdent("length", 37), 37, ast.NewIdent("tags", 44)),
+							ast.NewConst("2", 50, token.INT),
+							49,
+						),
+						ast.NewBinaryExpr(
+							token.AND,
+							ast.NewBinaryExpr(token.GTR, ast.NewIdent("scores", 52), ast.NewQuantifiedExpr(ast.QuantAny, ast.NewConst("90", 63, token.INT), 59), 58),
+							ast.NewBinaryExpr(
+								token.AND,
+								ast.NewBinaryExpr(token.LEQ, ast.NewIdent("scores", 67), ast.NewQuantifiedExpr(ast.QuantAll, ast.NewConst("100", 79, token.INT), 75), 73),
+								ast.NewBinaryExpr(token.NEQ, ast.NewIdent("tags", 84), ast.NewConst("x", 90, token.STRING), 88),
+								83,
+							),
+							66,
+						),
+						51,
+					),
+					36,
+				),
+				21,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeString, "tags", "tags", true),
+					source.NewCol(source.TypeNumber, "scores", "scores", true),
+				),
+			},
+		},
+		Result: `select * from table q where q.tags @> '["a", "it''s"]' and not (exists (select 1 from jsonb_array_elements_text(q.tags::jsonb) e(v) where e.v::text in ('c'))) and jsonb_array_length(q.tags::jsonb) > 2 and exists (select 1 from jsonb_array_elements_text(q.scores::jsonb) e(v) where e.v::numeric > 90) and not exists (select 1 from jsonb_array_elements_text(q.scores::jsonb) e(v) where not (e.v::numeric <= 100)) and not q.tags @> '"x"'`,
+	},
+	{
+		Name:   "Array none",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.EQL,
+				ast.NewIdent("scores", 1),
+				ast.NewQuantifiedExpr(ast.QuantNone, ast.NewExprList(14, ast.NewConst("1", 15, token.INT), ast.NewConst("2.5", 17, token.FLOAT)), 9),
+				8,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "scores", "scores", true)),
+			},
+		},
+		Result: `select * from table q where not exists (select 1 from jsonb_array_elements_text(q.scores::jsonb) e(v) where e.v::numeric in (1, 2.5))`,
+	},
+	{
+		Name:   "Dotted path",
+		Target: "table",
+		Query: &Query{
+			fields: ast.NewIdentList(ast.NewIdent("id", 1), ast.NewIdent("address.city", 4)),
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("address.city", 31), ast.NewConst("Oslo", 44, token.STRING), 43),
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewBinaryExpr(token.GEQ, ast.NewIdent("address.geo.lat", 52), ast.NewConst("59.9", 69, token.FLOAT), 67),
+					ast.NewBinaryExpr(
+						token.AND,
+						ast.NewBinaryExpr(token.LIKE, ast.NewIdent("address.street", 75), ast.NewConst("gate", 92, token.STRING), 90),
+						ast.NewBinaryExpr(
+							token.EQL,
+							ast.NewIdent("address.tags", 99),
+							ast.NewQuantifiedExpr(ast.QuantAny, ast.NewExprList(116, ast.NewConst("a", 117, token.STRING)), 113),
+							112,
+						),
+						98,
+					),
+					74,
+				),
+				51,
+			),
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("address.geo.lat", 125), ast.NewOrderByDir(ast.OrderDesc, 124, token.MINUS)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeObject, "address", "addr", false).WithChildren(source.NewCols(
+						source.NewCol(source.TypeString, "city", "city", false),
+						source.NewCol(source.TypeString, "street", "street_name", false),
+						source.NewCol(source.TypeString, "tags", "tags", true),
+						source.NewCol(source.TypeObject, "geo", "geo", false).WithChildren(source.NewCols(
+							source.NewCol(source.TypeNumber, "lat", "lat", false),
+						)),
+					)),
+				),
+			},
+		},
+		Result: `select q.id, (q.addr #>> '{city}')::text as "address.city" from table q where (q.addr #>> '{city}')::text = 'Oslo' and (q.addr #>> '{geo,lat}')::numeric >= 59.9 and (q.addr #>> '{street_name}')::text like '%gate%' and exists (select 1 from jsonb_array_elements_text((q.addr #> '{tags}')::jsonb) e(v) where e.v::text in ('a')) order by (q.addr #>> '{geo,lat}')::numeric desc`,
+	},
+	{
+		Name:   "Semi-joins",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewCallExpr(ast.NewIdent("$exists", 11), 11, ast.NewSubqueryExpr(
+					ast.NewIdent("orders", 19),
+					nil,
+					ast.NewExprList(26,
+						ast.NewBinaryExpr(token.EQL, ast.NewIdent("customer_id", 27), ast.NewIdent("$outer.id", 39), 38),
+						ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 49), ast.NewConst("open", 56, token.STRING), 55),
+					),
+					19,
+				)),
+				ast.NewBinaryExpr(
+					token.NEQ,
+					ast.NewIdent("id", 65),
+					ast.NewSubqueryExpr(
+						ast.NewIdent("orders", 70),
+						ast.NewIdent("customer_id", 77),
+						ast.NewBinaryExpr(token.GTR, ast.NewIdent("total", 89), ast.NewConst("100", 95, token.INT), 94),
+						69,
+					),
+					67,
+				),
+				64,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "customer_id", "customer_id", false),
+							source.NewCol(source.TypeString, "status", "status", false),
+							source.NewCol(source.TypeNumber, "total", "total", false),
+						),
+					}, "id", "customer_id"),
+				),
+			},
+		},
+		Result: `select * from customers q where exists (select 1 from orders r where r.customer_id = q.id and r.customer_id = q.id and r.status = 'open') and q.id not in (select r.customer_id from orders r where r.total > 100)`,
+	},
+	{
+		Name:   "Semi-join with outer column of the same name",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewCallExpr(ast.NewIdent("$exists", 1), 1, ast.NewSubqueryExpr(
+				ast.NewIdent("orders", 9),
+				nil,
+				ast.NewExprList(16,
+					ast.NewBinaryExpr(token.EQL, ast.NewIdent("customer_id", 17), ast.NewIdent("$outer.id", 29), 28),
+					ast.NewBinaryExpr(token.NEQ, ast.NewIdent("id", 39), ast.NewIdent("$outer.last_order", 42), 40),
+				),
+				9,
+			)),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeNumber, "last_order", "last_order_id", false),
+				),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "id", "id", false),
+							source.NewCol(source.TypeNumber, "customer_id", "customer_id", false),
+						),
+					}, "", ""),
+				),
+			},
+		},
+		Result: `select * from customers q where exists (select 1 from orders r where r.customer_id = q.id and r.id != q.last_order_id)`,
+	},
+	{
+		Name:   "Semi-join without condition",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewUnaryExpr(token.NOT, ast.NewCallExpr(ast.NewIdent("$exists", 2), 2, ast.NewIdent("orders", 10)), 1),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "customer_id", "customer_id", false),
+							source.NewCol(source.TypeString, "status", "status", false),
+							source.NewCol(source.TypeNumber, "total", "total", false),
+						),
+					}, "id", "customer_id"),
+				),
+			},
+		},
+		Result: `select * from customers q where not exists (select 1 from orders r where r.customer_id = q.id)`,
+	},
+	{
+		Name:   "Embedded fields",
+		Target: "orders",
+		Query: &Query{
+			fields: ast.NewIdentList(
+				ast.NewIdent("id", 1),
+				ast.NewIdent("customer", 4).WithFields(ast.NewIdentList(ast.NewIdent("name", 13), ast.NewIdent("email", 18))),
+				ast.NewIdent("items", 25).WithFields(ast.NewIdentList(ast.NewIdent("sku", 31), ast.NewIdent("qty", 35))),
+				ast.NewIdent("tags", 40).WithFields(ast.NewIdentList(ast.NewIdent("name", 45))),
+			),
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("customer.name", 58), ast.NewConst("Bob", 72, token.STRING), 71),
+				ast.NewBinaryExpr(token.GTR, ast.NewIdent("items.qty", 79), ast.NewConst("1", 89, token.INT), 88),
+				78,
+			),
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("customer.name", 93), ast.NewOrderByDir(ast.OrderDesc, 92, token.MINUS)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeNumber, "customer_id", "customer_id", false),
+				),
+				Relations: source.NewRelations(
+					source.NewRelation("customer", "customers", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "id", "id", false),
+							source.NewCol(source.TypeString, "name", "name", false),
+							source.NewCol(source.TypeString, "email", "email", false),
+						),
+					}, "customer_id", "id").WithKind(source.OneToOne),
+					source.NewRelation("items", "order_items", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "order_id", "order_id", false),
+							source.NewCol(source.TypeString, "sku", "sku", false),
+							source.NewCol(source.TypeNumber, "qty", "qty", false),
+						),
+					}, "id", "order_id"),
+					source.NewRelation("tags", "tags", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "id", "id", false),
+							source.NewCol(source.TypeString, "name", "name", false),
+						),
+					}, "id", "id").WithLink("order_tags", "order_id", "tag_id"),
+				),
+			},
+		},
+		Result: `select q.id, "customer".data as "customer", "items".data as "items", "tags".data as "tags" from orders q ` +
+			`left join lateral (select json_build_object('name', r.name, 'email', r.email) data from customers r where r.id = q.customer_id limit 1) "customer" on true ` +
+			`left join lateral (select coalesce(json_agg(json_build_object('sku', r.sku, 'qty', r.qty)), '[]') data from order_items r where r.order_id = q.id) "items" on true ` +
+			`left join lateral (select coalesce(json_agg(json_build_object('name', r.name)), '[]') data from tags r join order_tags l on l.tag_id = r.id where l.order_id = q.id) "tags" on true ` +
+			`where exists (select 1 from customers r where r.id = q.customer_id and r.name = 'Bob') and exists (select 1 from order_items r where r.order_id = q.id and r.qty > 1) ` +
+			`order by (select r.name from customers r where r.id = q.customer_id limit 1) desc`,
+	},
+	{
+		Name:   "Nested embedded fields",
+		Target: "orders",
+		Query: &Query{
+			fields: ast.NewIdentList(
+				ast.NewIdent("items", 1).WithFields(ast.NewIdentList(
+					ast.NewIdent("qty", 7),
+					ast.NewIdent("product", 11).WithFields(ast.NewIdentList(ast.NewIdent("name", 19))),
+				)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+				Relations: source.NewRelations(
+					source.NewRelation("items", "order_items", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "order_id", "order_id", false),
+							source.NewCol(source.TypeNumber, "product_id", "product_id", false),
+							source.NewCol(source.TypeNumber, "qty", "qty", false),
+						),
+						Relations: source.NewRelations(
+							source.NewRelation("product", "products", &source.Source{
+								Cols: source.NewCols(
+									source.NewCol(source.TypeNumber, "id", "id", false),
+									source.NewCol(source.TypeString, "name", "name", false),
+								),
+							}, "product_id", "id").WithKind(source.OneToOne),
+						),
+					}, "id", "order_id"),
+				),
+			},
+		},
+		Result: `select "items".data as "items" from orders q ` +
+			`left join lateral (select coalesce(json_agg(json_build_object('qty', r.qty, 'product', "product".data)), '[]') data from order_items r ` +
+			`left join lateral (select json_build_object('name', r2.name) data from products r2 where r2.id = r.product_id limit 1) "product" on true ` +
+			`where r.order_id = q.id) "items" on true`,
+	},
+	{
+		Name:   "Typed values",
+		Target: "orders",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewConst("123e4567-e89b-12d3-a456-426614174000", 4, token.STRING), 3),
+					ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 44), ast.NewExprList(52, ast.NewConst("new", 53, token.STRING), ast.NewConst("paid", 59, token.STRING)), 50),
+					43,
+				),
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewBinaryExpr(
+						token.AND,
+						ast.NewBinaryExpr(token.LSS, ast.NewIdent("total", 67), ast.NewConst("10.25", 73, token.FLOAT), 72),
+						ast.NewBinaryExpr(token.GTR, ast.NewIdent("ttl", 80), ast.NewConst("1h", 84, token.INTERVAL), 83),
+						79,
+					),
+					ast.NewBinaryExpr(token.GEQ, ast.NewIdent("shipped", 88), ast.NewConst("2020-05-17", 97, token.STRING), 95),
+					87,
+				),
+				66,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeUUID, "id", "id", false),
+					source.NewCol(source.TypeEnum, "status", "status", false).WithValues("new", "paid", "shipped"),
+					source.NewCol(source.TypeDecimal, "total", "total", false).WithScale(2),
+					source.NewCol(source.TypeInterval, "ttl", "ttl", false),
+					source.NewCol(source.TypeDate, "shipped", "shipped", false),
+				),
+			},
+		},
+		Result: "select * from orders q where q.id = '123e4567-e89b-12d3-a456-426614174000'::uuid and q.status in ('new', 'paid') and q.total < 10.25::numeric and q.ttl > interval '1 hours' and q.shipped >= '2020-05-17'::date",
+	},
+	{
+		Name:   "Typed values in list",
+		Target: "orders",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("shipped", 1), ast.NewExprList(9, ast.NewConst("2020-05-17", 10, token.STRING), ast.NewConst("2020-05-18", 23, token.STRING)), 8),
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("total", 37), ast.NewExprList(43, ast.NewConst("2", 44, token.INT), ast.NewUnaryExpr(token.MINUS, ast.NewConst("1.5", 47, token.FLOAT), 46)), 42),
+				36,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeDecimal, "total", "total", false),
+					source.NewCol(source.TypeDate, "shipped", "shipped", false),
+				),
+			},
+		},
+		Result: "select * from orders q where q.shipped in ('2020-05-17'::date, '2020-05-18'::date) and q.total in (2::numeric, -1.5::numeric)",
+	},
+	{
+		Name:   "Typed values in sqlite",
+		Target: "orders",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewConst("123e4567-e89b-12d3-a456-426614174000", 4, token.STRING), 3),
+				ast.NewBinaryExpr(token.GEQ, ast.NewIdent("shipped", 44), ast.NewConst("2020-05-17", 53, token.STRING), 51),
+				43,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeUUID, "id", "id", false),
+					source.NewCol(source.TypeDate, "shipped", "shipped", false),
+				),
+			},
+			dialect: SQLite,
+		},
+		Result: "select * from orders q where q.id = '123e4567-e89b-12d3-a456-426614174000' and q.shipped >= '2020-05-17'",
+	},
+	{
+		Name:   "Capabilities",
+		Target: "users",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.GTR, ast.NewIdent("age", 1), ast.NewConst("18", 5, token.INT), 4),
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("phone", 9), ast.NewConst("+100", 15, token.STRING), 14),
+				8,
+			),
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("name", 23), ast.NewOrderByDir(ast.OrderAsc, 22, token.PLUS)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "age", "age", false),
+					source.NewCol(source.TypeString, "name", "name", false).WithDenied(source.Filterable),
+					source.NewCol(source.TypeString, "phone", "phone", false).WithDenied(source.Selectable|source.Sortable),
+					source.NewCol(source.TypeString, "password", "password", false).WithHidden(),
+				),
+			},
+		},
+		Result: "select q.age, q.name from users q where q.age > 18 and q.phone = '+100' order by name asc",
+	},
+	{
+		Name:   "Required columns",
+		Target: "events",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewBinaryExpr(token.EQL, ast.NewIdent("tenant", 1), ast.NewConst("7", 8, token.INT), 7),
+					ast.NewBinaryExpr(token.OR,
+						ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 11), ast.NewConst("new", 18, token.STRING), 17),
+						ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 25), ast.NewConst("lost", 32, token.STRING), 31),
+						24,
+					),
+					9,
+				),
+				ast.NewBinaryExpr(token.GEQ, ast.NewIdent("day", 40), ast.NewConst("2020-05-17", 45, token.STRING), 43),
+				39,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					&source.Col{Type: source.TypeNumber, Name: "tenant", DBName: "tenant_id", Required: true},
+					&source.Col{Type: source.TypeTime, Name: "day", DBName: "day", Required: true},
+					source.NewCol(source.TypeString, "status", "status", false),
+				),
+			},
+		},
+		Result: "select * from events q where q.tenant_id = 7 and (q.status = 'new' or q.status = 'lost') and q.day >= '2020-05-17'",
+	},
+	{
+		Name:   "Computed columns",
+		Target: "users",
+		Query: &Query{
+			fields: ast.NewIdentList(ast.NewIdent("fullName", 1), ast.NewIdent("age", 10)),
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.GTR, ast.NewIdent("age", 15), ast.NewConst("18", 19, token.INT), 18),
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("fullName", 22), ast.NewConst("Bob Smith", 31, token.STRING), 30),
+				21,
+			),
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("age", 44), ast.NewOrderByDir(ast.OrderDesc, 43, token.MINUS)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeString, "fullName", "", false).WithExpr("{q}.first || ' ' || {q}.last"),
+					source.NewCol(source.TypeNumber, "age", "", false).WithExpr("date_part('year', age({q}.birth))"),
+				),
+			},
+		},
+		Result: `select (q.first || ' ' || q.last) as "fullName", (date_part('year', age(q.birth))) as "age" from users q ` +
+			`where (date_part('year', age(q.birth))) > 18 and (q.first || ' ' || q.last) = 'Bob Smith' ` +
+			`order by (date_part('year', age(q.birth))) desc`,
+	},
+	{
+		Name:   "Computed column without selected fields",
+		Target: "users",
+		Query: &Query{
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeString, "fullName", "", false).WithExpr("{q}.first || ' ' || {q}.last"),
+				),
+			},
+		},
+		Result: `select (q.first || ' ' || q.last) as "fullName", q.id from users q`,
+	},
+	{
+		Name:   "Native arrays",
+		Target: "posts",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewBinaryExpr(token.EQL, ast.NewIdent("tags", 1), ast.NewConst("a", 6, token.STRING), 5),
+					ast.NewBinaryExpr(token.NEQ, ast.NewIdent("tags", 10), ast.NewConst("b", 16, token.STRING), 14),
+					9,
+				),
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewBinaryExpr(
+						token.AND,
+						ast.NewBinaryExpr(token.EQL, ast.NewIdent("tags", 20), ast.NewQuantifiedExpr(ast.QuantAll, ast.NewExprList(29, ast.NewConst("x", 30, token.STRING), ast.NewConst("y", 34, token.STRING)), 25), 24),
+						ast.NewBinaryExpr(token.GTR, ast.NewIdent("scores", 39), ast.NewQuantifiedExpr(ast.QuantAny, ast.NewConst("90", 50, token.INT), 46), 45),
+						38,
+					),
+					ast.NewBinaryExpr(token.GTR, ast.NewCallExpr(ast.NewIdent("length", 54), 54, ast.NewIdent("tags", 61)), ast.NewConst("2", 67, token.INT), 66),
+					53,
+				),
+				19,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeString, "tags", "tags", true).WithStorage(source.StorageArray),
+					source.NewCol(source.TypeNumber, "scores", "scores", true).WithStorage(source.StorageArray),
+				),
+			},
+		},
+		Result: "select * from posts q where 'a' = any(q.tags) and 'b' != all(q.tags) and q.tags @> array['x', 'y']::text[] and " +
+			"exists (select 1 from unnest(q.scores) e(v) where e.v > 90) and cardinality(q.tags) > 2",
+	},
+	{
+		Name:   "Array is null",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("b", 1), ast.NewIdent("null", 3), 2),
+				ast.NewBinaryExpr(token.NEQ, ast.NewIdent("n", 9), ast.NewIdent("null", 12), 10),
+				8,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeString, "b", "b", true),
+					source.NewCol(source.TypeNumber, "n", "n", true),
+				),
+			},
+		},
+		Result: "select * from table q where q.b is null and q.n is not null",
+	},
+	{
+		Name:   "Native array is null",
+		Target: "posts",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("tags", 1), ast.NewIdent("null", 6), 5),
+				ast.NewBinaryExpr(token.NEQ, ast.NewIdent("scores", 12), ast.NewIdent("null", 20), 18),
+				11,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeString, "tags", "tags", true).WithStorage(source.StorageArray),
+					source.NewCol(source.TypeNumber, "scores", "scores", true).WithStorage(source.StorageArray),
+				),
+			},
+		},
+		Result: "select * from posts q where q.tags is null and q.scores is not null",
+	},
+	{
+		Name:   "Child tables",
+		Target: "orders",
+		Query: &Query{
+			fields: ast.NewIdentList(ast.NewIdent("id", 1), ast.NewIdent("items", 4)),
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewBinaryExpr(token.EQL, ast.NewIdent("items", 11), ast.NewExprList(17,
+						ast.NewBinaryExpr(token.EQL, ast.NewIdent("sku", 18), ast.NewConst("a", 22, token.STRING), 21),
+						ast.NewBinaryExpr(token.GTR, ast.NewIdent("qty", 27), ast.NewConst("1", 31, token.INT), 30),
+					), 16),
+					ast.NewBinaryExpr(token.EQL, ast.NewIdent("items", 35), ast.NewQuantifiedExpr(ast.QuantAll, ast.NewExprList(45,
+						ast.NewBinaryExpr(token.GTR, ast.NewIdent("qty", 46), ast.NewConst("0", 50, token.INT), 49),
+					), 41), 40),
+					34,
+				),
+				ast.NewBinaryExpr(
+					token.AND,
+					ast.NewBinaryExpr(token.EQL, ast.NewIdent("address.city", 54), ast.NewConst("X", 68, token.STRING), 67),
+					ast.NewBinaryExpr(token.GTR, ast.NewCallExpr(ast.NewIdent("length", 73), 73, ast.NewIdent("items", 80)), ast.NewConst("2", 87, token.INT), 86),
+					72,
+				),
+				53,
+			),
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("address.city", 90), ast.NewOrderByDir(ast.OrderAsc, 89, token.PLUS)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeObject, "items", "items", true).WithChildTable("order_items", "id", "order_id").WithChildren(source.NewCols(
+						source.NewCol(source.TypeString, "sku", "sku", false),
+						source.NewCol(source.TypeNumber, "qty", "qty", false),
+					)),
+					source.NewCol(source.TypeObject, "address", "address", false).WithChildTable("addresses", "id", "order_id").WithChildren(source.NewCols(
+						source.NewCol(source.TypeString, "city", "city", false),
+					)),
+				),
+			},
+		},
+		Result: `select q.id, "items".data as "items" from orders q ` +
+			`left join lateral (select coalesce(json_agg(json_build_object('qty', r.qty, 'sku', r.sku)), '[]') data from order_items r where r.order_id = q.id) "items" on true ` +
+			`where exists (select 1 from order_items r where r.order_id = q.id and r.sku = 'a' and r.qty > 1) and ` +
+			`not exists (select 1 from order_items r where r.order_id = q.id and (r.qty > 0) is not true) and ` +
+			`exists (select 1 from addresses r where r.order_id = q.id and r.city = 'X') and ` +
+			`(select count(*) from order_items r where r.order_id = q.id) > 2 ` +
+			`order by (select r.city from addresses r where r.order_id = q.id limit 1) asc`,
+	},
+	{
+		Name:   "Policy",
+		Target: "docs",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 1), ast.NewConst("new", 8, token.STRING), 7),
+			policy: ast.NewBinaryExpr(
+				token.OR,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("tenant", 0), ast.NewConst("7", 0, token.INT), 0),
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("public", 0), ast.NewIdent("true", 0), 0),
+				0,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "tenant", "tenant_id", false).WithHidden(),
+					source.NewCol(source.TypeBool, "public", "public", false).WithDenied(source.Filterable),
+					source.NewCol(source.TypeString, "status", "status", false),
+				),
+			},
+		},
+		Result: "select q.public, q.status from docs q where (q.tenant_id = 7 or q.public = true) and q.status = 'new'",
+	},
+	{
+		Name:   "Soft delete",
+		Target: "orders",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 1), ast.NewConst("new", 8, token.STRING), 7),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeString, "status", "status", false),
+					source.NewCol(source.TypeTime, "deleted", "deleted_at", false).WithHidden(),
+				),
+				Deleted: "deleted",
+			},
+		},
+		Result: "select q.id, q.status from orders q where q.deleted_at is null and q.status = 'new'",
+	},
+	{
+		Name:   "With deleted",
+		Target: "orders",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewIdent("$withDeleted", 1),
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 18), ast.NewConst("new", 25, token.STRING), 24),
+				14,
+			),
+			deletedAllowed: true,
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeString, "status", "status", false),
+					source.NewCol(source.TypeTime, "deleted", "deleted_at", false).WithHidden(),
+				),
+				Deleted: "deleted",
+			},
+		},
+		Result: "select q.id, q.status from orders q where q.status = 'new'",
+	},
+	{
+		Name:   "Semi-joins with soft delete",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewCallExpr(ast.NewIdent("$exists", 1), 1, ast.NewIdent("orders", 9)),
+				ast.NewBinaryExpr(
+					token.EQL,
+					ast.NewIdent("id", 20),
+					ast.NewSubqueryExpr(
+						ast.NewIdent("orders", 23),
+						ast.NewIdent("customer_id", 30),
+						ast.NewBinaryExpr(
+							token.OR,
+							ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 42), ast.NewConst("new", 49, token.STRING), 48),
+							ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 55), ast.NewConst("paid", 62, token.STRING), 61),
+							54,
+						),
+						22,
+					),
+					21,
+				),
+				17,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "customer_id", "customer_id", false),
+							source.NewCol(source.TypeString, "status", "status", false),
+							source.NewCol(source.TypeTime, "deleted", "deleted_at", false),
+						),
+						Deleted: "deleted",
+					}, "id", "customer_id"),
+				),
+			},
+		},
+		Result: "select * from customers q where exists (select 1 from orders r where r.customer_id = q.id and r.deleted_at is null) " +
+			"and q.id in (select r.customer_id from orders r where (r.status = 'new' or r.status = 'paid') and r.deleted_at is null)",
+	},
+	{
+		Name:   "Policies of related sources",
+		Target: "customers",
+		Query: &Query{
+			fields: ast.NewIdentList(
+				ast.NewIdent("id", 1),
+				ast.NewIdent("orders", 4).WithFields(ast.NewIdentList(ast.NewIdent("id", 11))),
+			),
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewCallExpr(ast.NewIdent("$exists", 16), 16, ast.NewIdent("orders", 24)),
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 33), ast.NewSubqueryExpr(ast.NewIdent("orders", 37), ast.NewIdent("customer_id", 44), nil, 36), 35),
+				32,
+			),
+			policy:        tenantPolicy("7"),
+			relatedPolicy: relatedTenantPolicy,
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeNumber, "tenant", "tenant_id", false).WithHidden(),
+				),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "id", "id", false),
+							source.NewCol(source.TypeNumber, "customer_id", "customer_id", false),
+							source.NewCol(source.TypeNumber, "tenant", "tenant_id", false).WithHidden(),
+						),
+					}, "id", "customer_id"),
+				),
+			},
+		},
+		Result: `select q.id, "orders".data as "orders" from customers q ` +
+			`left join lateral (select coalesce(json_agg(json_build_object('id', r.id)), '[]') data from orders r where r.customer_id = q.id and r.tenant_id = 7) "orders" on true ` +
+			`where q.tenant_id = 7 and exists (select 1 from orders r where r.customer_id = q.id and r.tenant_id = 7) ` +
+			`and q.id in (select r.customer_id from orders r where r.tenant_id = 7)`,
+	},
+	{
+		Name:   "Roles",
+		Target: "employees",
+		Query: &Query{
+			fields:    ast.NewIdentList(ast.NewIdent("id", 1), ast.NewIdent("salary", 4)),
+			condition: ast.NewBinaryExpr(token.GTR, ast.NewIdent("salary", 12), ast.NewConst("1000", 19, token.INT), 18),
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("salary", 26), ast.NewOrderByDir(ast.OrderDesc, 25, token.MINUS)),
+			),
+			roles: []string{"hr"},
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeString, "name", "name", false),
+					source.NewCol(source.TypeDecimal, "salary", "salary", false).WithRole("hr", source.AllCapabilities),
+					source.NewCol(source.TypeNumber, "score", "score", false).WithRole("staff", source.Selectable),
+				),
+			},
+		},
+		Result: "select q.id, q.salary from employees q where q.salary > 1000::numeric order by salary desc",
+	},
+	{
+		Name:   "Drop denied for roles",
+		Target: "employees",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.AND,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("name", 1), ast.NewConst("bob", 6, token.STRING), 5),
+				ast.NewExprList(12, ast.NewBinaryExpr(
+					token.OR,
+					ast.NewBinaryExpr(token.GTR, ast.NewIdent("salary", 13), ast.NewConst("1000", 20, token.INT), 19),
+					ast.NewBinaryExpr(token.GTR, ast.NewIdent("score", 25), ast.NewConst("5", 31, token.INT), 30),
+					24,
+				)),
+				11,
+			),
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("salary", 36), ast.NewOrderByDir(ast.OrderDesc, 35, token.MINUS)),
+				ast.NewOrderByStmt(ast.NewIdent("name", 44), ast.NewOrderByDir(ast.OrderAsc, 43, token.PLUS)),
+			),
+			roles:  []string{"support"},
+			access: DropDenied,
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeString, "name", "name", false),
+					source.NewCol(source.TypeDecimal, "salary", "salary", false).WithRole("hr", source.AllCapabilities),
+					source.NewCol(source.TypeNumber, "score", "score", false).WithRole("staff", source.Selectable),
+				),
+			},
+		},
+		Result: "select q.id, q.name from employees q where q.name = 'bob' order by name asc",
+	},
+}
+
+func TestCompile(t *testing.T) {
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			sql, err := c.Query.Compile(c.Target)
+			if err != nil {
+				t.Errorf("expected err: %v, got: %v", nil, err)
+				t.FailNow()
+			}
+
+			if sql != c.Result {
+				t.Errorf("expected: %v, got: %v", c.Result, sql)
+				t.Fail()
+			}
+		})
+	}
+}
+
+var errorCases = []struct {
+	Name   string
+	Target string
+	Query  *Query
+}{
+	{
+		Name:   "Relative time with not time column",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.GTR, ast.NewIdent("a", 5), ast.NewIdent("now", 7), 6),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "a", "a", false)),
+			},
+		},
+	},
+	{
+		Name:   "Hidden raw JSON column",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewCallExpr(ast.NewIdent("has", 1), 1, ast.NewIdent("meta.tags", 5)),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeJSON, "meta", "meta", false).WithHidden()),
+			},
+		},
+	},
+	{
+		Name:   "Has with unknown column",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewCallExpr(ast.NewIdent("has", 1), 1, ast.NewIdent("a.b", 5)),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeObject, "a", "a", false)),
+			},
+		},
+	},
+	{
+		Name:   "Regex is not allowed",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.REGEX, ast.NewIdent("a", 1), ast.NewConst("x", 4, token.STRING), 2),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeString, "a", "a", false)),
+			},
+		},
+	},
+	{
+		Name:   "Like with number",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.LIKE, ast.NewIdent("a", 1), ast.NewConst("1", 4, token.INT), 2),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeString, "a", "a", false)),
+			},
+		},
+	},
+	{
+		Name:   "Search without declaration",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.MATCH, ast.NewIdent("$search", 1), ast.NewConst("x", 10, token.STRING), 8),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeString, "a", "a", false)),
+			},
+		},
+	},
+	{
+		Name:   "Rank without search",
+		Target: "table",
+		Query: &Query{
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("$rank", 2), ast.NewOrderByDir(ast.OrderDesc, 1, token.MINUS)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeString, "a", "a", false)),
+			},
+		},
+	},
+	{
+		Name:   "Quantifier with not array",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.GTR, ast.NewIdent("a", 1), ast.NewQuantifiedExpr(ast.QuantAny, ast.NewConst("1", 7, token.INT), 3), 2),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "a", "a", false)),
+			},
+		},
+	},
+	{
+		Name:   "Quantifier with wrong element type",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.GTR, ast.NewIdent("a", 1), ast.NewQuantifiedExpr(ast.QuantAny, ast.NewConst("1", 7, token.STRING), 3), 2),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "a", "a", true)),
+			},
+		},
+	},
+	{
+		Name:   "Dotted path through array",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("a.b", 1), ast.NewConst("x", 5, token.STRING), 4),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeObject, "a", "a", true).WithChildren(source.NewCols(
+						source.NewCol(source.TypeString, "b", "b", false),
+					)),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Semi-join with unknown relation",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewCallExpr(ast.NewIdent("$exists", 1), 1, ast.NewIdent("payments", 9)),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "customer_id", "customer_id", false),
+							source.NewCol(source.TypeString, "status", "status", false),
+							source.NewCol(source.TypeNumber, "total", "total", false),
+						),
+					}, "id", "customer_id"),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Semi-join with field of different type",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewSubqueryExpr(ast.NewIdent("orders", 5), ast.NewIdent("status", 12), nil, 4), 3),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "customer_id", "customer_id", false),
+							source.NewCol(source.TypeString, "status", "status", false),
+							source.NewCol(source.TypeNumber, "total", "total", false),
+						),
+					}, "id", "customer_id"),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Outer column in query without outer query",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewIdent("$outer.id", 4), 3),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+			},
+		},
+	},
+	{
+		Name:   "Outer column without prefix in semi-join",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewCallExpr(ast.NewIdent("$exists", 1), 1, ast.NewSubqueryExpr(
+				ast.NewIdent("orders", 9),
+				nil,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("customer_id", 17), ast.NewIdent("id", 29), 28),
+				9,
+			)),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(source.NewCol(source.TypeNumber, "customer_id", "customer_id", false)),
+					}, "", ""),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Undefined outer column in semi-join",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewCallExpr(ast.NewIdent("$exists", 1), 1, ast.NewSubqueryExpr(
+				ast.NewIdent("orders", 9),
+				nil,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("customer_id", 17), ast.NewIdent("$outer.customer_id", 29), 28),
+				9,
+			)),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(source.NewCol(source.TypeNumber, "customer_id", "customer_id", false)),
+					}, "", ""),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Hidden outer column in semi-join",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewCallExpr(ast.NewIdent("$exists", 1), 1, ast.NewSubqueryExpr(
+				ast.NewIdent("orders", 9),
+				nil,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("customer_id", 17), ast.NewIdent("$outer.secret", 29), 28),
+				9,
+			)),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeNumber, "secret", "secret", false).WithHidden(),
+				),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(source.NewCol(source.TypeNumber, "customer_id", "customer_id", false)),
+					}, "", ""),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Sort by field of to-many relation",
+		Target: "orders",
+		Query: &Query{
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("items.qty", 2), ast.NewOrderByDir(ast.OrderAsc, 1, token.PLUS)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+				Relations: source.NewRelations(
+					source.NewRelation("items", "order_items", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "order_id", "order_id", false),
+							source.NewCol(source.TypeNumber, "qty", "qty", false),
+						),
+					}, "id", "order_id"),
+				),
+			},
+		},
+	},
+	{
+		Name:   "UUID with not uuid string",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewConst("abc", 4, token.STRING), 3),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeUUID, "id", "id", false)),
+			},
+		},
+	},
+	{
+		Name:   "Value outside of enum",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 1), ast.NewExprList(8, ast.NewConst("new", 9, token.STRING), ast.NewConst("lost", 15, token.STRING)), 7),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeEnum, "status", "status", false).WithValues("new", "paid")),
+			},
+		},
+	},
+	{
+		Name:   "Decimal with greater scale",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.GTR, ast.NewIdent("total", 1), ast.NewConst("1.255", 7, token.FLOAT), 6),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeDecimal, "total", "total", false).WithScale(2)),
+			},
+		},
+	},
+	{
+		Name:   "Integer with float",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewConst("1.5", 4, token.FLOAT), 3),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeInteger, "id", "id", false)),
+			},
+		},
+	},
+	{
+		Name:   "Date with time",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("d", 1), ast.NewConst("2020-05-17 10:30", 3, token.STRING), 2),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeDate, "d", "d", false)),
+			},
+		},
+	},
+	{
+		Name:   "Filter by not filterable column",
+		Target: "users",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("name", 1), ast.NewConst("bob", 6, token.STRING), 5),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "age", "age", false),
+					source.NewCol(source.TypeString, "name", "name", false).WithDenied(source.Filterable),
+					source.NewCol(source.TypeString, "phone", "phone", false).WithDenied(source.Selectable|source.Sortable),
+					source.NewCol(source.TypeString, "password", "password", false).WithHidden(),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Filter by hidden column",
+		Target: "users",
+		Query: &Query{
+			condition: ast.NewUnaryExpr(token.NOT, ast.NewBinaryExpr(token.EQL, ast.NewIdent("password", 2), ast.NewConst("x", 11, token.STRING), 10), 1),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "age", "age", false),
+					source.NewCol(source.TypeString, "name", "name", false).WithDenied(source.Filterable),
+					source.NewCol(source.TypeString, "phone", "phone", false).WithDenied(source.Selectable|source.Sortable),
+					source.NewCol(source.TypeString, "password", "password", false).WithHidden(),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Filter by hidden child of object",
+		Target: "users",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.EQL,
+				ast.NewIdent("addr", 1),
+				ast.NewExprList(6, ast.NewBinaryExpr(token.EQL, ast.NewIdent("secret", 7), ast.NewConst("x", 14, token.STRING), 13)),
+				5,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeObject, "addr", "addr", false).WithChildren(source.NewCols(
+						source.NewCol(source.TypeString, "city", "city", false),
+						source.NewCol(source.TypeString, "secret", "secret", false).WithHidden(),
+					)),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Filter by not filterable child of object",
+		Target: "users",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.EQL,
+				ast.NewIdent("addr", 1),
+				ast.NewExprList(6, ast.NewBinaryExpr(token.EQL, ast.NewIdent("nof", 7), ast.NewConst("x", 11, token.STRING), 10)),
+				5,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeObject, "addr", "addr", false).WithChildren(source.NewCols(
+						source.NewCol(source.TypeString, "city", "city", false),
+						source.NewCol(source.TypeString, "nof", "nof", false).WithDenied(source.Filterable),
+					)),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Filter by hidden child of array of object with quantifier",
+		Target: "orders",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.EQL,
+				ast.NewIdent("items", 1),
+				ast.NewQuantifiedExpr(ast.QuantAny, ast.NewExprList(11, ast.NewBinaryExpr(token.GTR, ast.NewIdent("cost", 12), ast.NewConst("5", 17, token.INT), 16)), 7),
+				6,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeObject, "items", "items", true).WithChildren(source.NewCols(
+						source.NewCol(source.TypeNumber, "qty", "qty", false),
+						source.NewCol(source.TypeNumber, "cost", "cost", false).WithHidden(),
+					)),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Has hidden child of object",
+		Target: "users",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(
+				token.EQL,
+				ast.NewIdent("addr", 1),
+				ast.NewExprList(6, ast.NewCallExpr(ast.NewIdent("has", 7), 7, ast.NewIdent("secret", 11))),
+				5,
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeObject, "addr", "addr", false).WithChildren(source.NewCols(
+						source.NewCol(source.TypeString, "city", "city", false),
+						source.NewCol(source.TypeString, "secret", "secret", false).WithHidden(),
+					)),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Semi-join with hidden field",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewSubqueryExpr(ast.NewIdent("orders", 5), ast.NewIdent("osecret", 12), nil, 4), 3),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(
+							source.NewCol(source.TypeNumber, "customer_id", "customer_id", false),
+							source.NewCol(source.TypeNumber, "osecret", "osecret", false).WithHidden(),
+						),
+					}, "id", "customer_id"),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Select not selectable column",
+		Target: "users",
+		Query: &Query{
+			fields: ast.NewIdentList(ast.NewIdent("age", 1), ast.NewIdent("phone", 5)),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "age", "age", false),
+					source.NewCol(source.TypeString, "name", "name", false).WithDenied(source.Filterable),
+					source.NewCol(source.TypeString, "phone", "phone", false).WithDenied(source.Selectable|source.Sortable),
+					source.NewCol(source.TypeString, "password", "password", false).WithHidden(),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Sort by not sortable column",
+		Target: "users",
+		Query: &Query{
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("phone", 2), ast.NewOrderByDir(ast.OrderDesc, 1, token.MINUS)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "age", "age", false),
+					source.NewCol(source.TypeString, "name", "name", false).WithDenied(source.Filterable),
+					source.NewCol(source.TypeString, "phone", "phone", false).WithDenied(source.Selectable|source.Sortable),
+					source.NewCol(source.TypeString, "password", "password", false).WithHidden(),
+				),
+			},
+		},
+	},
+	{
+		Name:   "With deleted is not allowed",
+		Target: "orders",
+		Query: &Query{
+			condition: ast.NewIdent("$withDeleted", 1),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeString, "status", "status", false),
+					source.NewCol(source.TypeTime, "deleted", "deleted_at", false).WithHidden(),
+				),
+				Deleted: "deleted",
+			},
+		},
+	},
+	{
+		Name:   "Select column denied for role",
+		Target: "employees",
+		Query: &Query{
+			fields: ast.NewIdentList(ast.NewIdent("id", 1), ast.NewIdent("salary", 4)),
+			roles:  []string{"support"},
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeString, "name", "name", false),
+					source.NewCol(source.TypeDecimal, "salary", "salary", false).WithRole("hr", source.AllCapabilities),
+					source.NewCol(source.TypeNumber, "score", "score", false).WithRole("staff", source.Selectable),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Filter by column denied for role",
+		Target: "employees",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.GTR, ast.NewIdent("score", 1), ast.NewConst("5", 7, token.INT), 6),
+			roles:     []string{"staff"},
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeString, "name", "name", false),
+					source.NewCol(source.TypeDecimal, "salary", "salary", false).WithRole("hr", source.AllCapabilities),
+					source.NewCol(source.TypeNumber, "score", "score", false).WithRole("staff", source.Selectable),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Sort by column denied for role",
+		Target: "employees",
+		Query: &Query{
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("salary", 2), ast.NewOrderByDir(ast.OrderDesc, 1, token.MINUS)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeString, "name", "name", false),
+					source.NewCol(source.TypeDecimal, "salary", "salary", false).WithRole("hr", source.AllCapabilities),
+					source.NewCol(source.TypeNumber, "score", "score", false).WithRole("staff", source.Selectable),
+				),
+			},
+		},
+	},
+	{
+		Name:   "All selected fields dropped for role",
+		Target: "employees",
+		Query: &Query{
+			fields: ast.NewIdentList(ast.NewIdent("salary", 1)),
+			roles:  []string{"support"},
+			access: DropDenied,
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeString, "name", "name", false),
+					source.NewCol(source.TypeDecimal, "salary", "salary", false).WithRole("hr", source.AllCapabilities),
+					source.NewCol(source.TypeNumber, "score", "score", false).WithRole("staff", source.Selectable),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Computed column with value of other type",
+		Target: "users",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("age", 1), ast.NewConst("old", 5, token.STRING), 4),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeString, "fullName", "", false).WithExpr("{q}.first || ' ' || {q}.last"),
+					source.NewCol(source.TypeNumber, "age", "", false).WithExpr("date_part('year', age({q}.birth))"),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Native array in sqlite",
+		Target: "posts",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("tags", 1), ast.NewConst("a", 6, token.STRING), 5),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeString, "tags", "tags", true).WithStorage(source.StorageArray)),
+			},
+			dialect: SQLite,
+		},
+	},
+	{
+		Name:   "Sort by child table of array",
+		Target: "orders",
+		Query: &Query{
+			orderBy: ast.NewOrderByStmtList(
+				ast.NewOrderByStmt(ast.NewIdent("items.qty", 2), ast.NewOrderByDir(ast.OrderAsc, 1, token.PLUS)),
+			),
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeObject, "items", "items", true).WithChildTable("order_items", "id", "order_id").WithChildren(source.NewCols(
+						source.NewCol(source.TypeNumber, "qty", "qty", false),
+					)),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Relation without keys under policy",
+		Target: "customers",
+		Query: &Query{
+			condition: ast.NewCallExpr(ast.NewIdent("$exists", 1), 1, ast.NewIdent("orders", 9)),
+			policy:    tenantPolicy("7"),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeNumber, "tenant", "tenant_id", false).WithHidden()),
+				Relations: source.NewRelations(
+					source.NewRelation("orders", "orders", &source.Source{
+						Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+					}, "", ""),
+				),
+			},
+		},
+	},
+	{
+		Name:   "Relative time with unknown unit",
+		Target: "table",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.GTR, ast.NewIdent("a", 5), ast.NewCallExpr(ast.NewIdent("startof", 7), 7, ast.NewIdent("decade", 15)), 6),
+			source: &source.Source{
+				Cols: source.NewCols(source.NewCol(source.TypeTime, "a", "a", false)),
+			},
+		},
+	},
+}
+
+// tenantPolicy returns policy tenant=id
+func tenantPolicy(id string) ast.Expr {
+	return ast.NewBinaryExpr(token.EQL, ast.NewIdent("tenant", 0), ast.NewConst(id, 0, token.INT), 0)
+}
+
+// relatedTenantPolicy returns policy tenant=7 of related sources with tenant column
+func relatedTenantPolicy(s *source.Source) (ast.Expr, error) {
+	if s.Cols["tenant"] == nil {
+		return nil, nil
+	}
+	return tenantPolicy("7"), nil
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, c := range errorCases {
+		t.Run(c.Name, func(t *testing.T) {
+			if sql, err := c.Query.Compile(c.Target); err == nil {
+				t.Errorf("expected error, got: %v", sql)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestMissingRequired(t *testing.T) {
+	q := &Query{
+		condition: ast.NewBinaryExpr(
+			token.OR,
+			ast.NewBinaryExpr(token.EQL, ast.NewIdent("tenant", 1), ast.NewConst("7", 8, token.INT), 7),
+			ast.NewBinaryExpr(token.NEQ, ast.NewIdent("day", 10), ast.NewIdent("null", 15), 13),
+			9,
+		),
+		source: &source.Source{
+			Cols: source.NewCols(
+				&source.Col{Type: source.TypeNumber, Name: "tenant", DBName: "tenant_id", Required: true},
+				&source.Col{Type: source.TypeTime, Name: "day", DBName: "day", Required: true},
+				source.NewCol(source.TypeString, "status", "status", false),
+			),
+		},
+	}
+	sql, err := q.Compile("events")
+	missing, ok := err.(*MissingRequiredError)
+	if !ok {
+		t.Errorf("expected MissingRequiredError, got: %v, %v", sql, err)
+		t.FailNow()
+	}
+	if expected := []string{"day", "tenant"}; !reflect.DeepEqual(missing.Cols, expected) {
+		t.Errorf("expected: %v, got: %v", expected, missing.Cols)
+		t.Fail()
+	}
+}
+
+func TestMissingRequiredDropped(t *testing.T) {
+	newQuery := func() *Query {
+		return &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("tenant", 1), ast.NewConst("7", 8, token.INT), 7),
+			roles:     []string{"guest"},
+			access:    DropDenied,
+			bulk:      true,
+			source: &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeInteger, "id", "id", false),
+					(&source.Col{Type: source.TypeNumber, Name: "tenant", DBName: "tenant_id", Required: true}).WithRole("admin", source.AllCapabilities),
+					source.NewCol(source.TypeString, "status", "status", false),
+					source.NewCol(source.TypeTime, "deleted", "deleted_at", false),
+				),
+				Deleted: "deleted",
+			},
+		}
+	}
+	if sql, err := newQuery().Compile("events"); !isMissingRequired(err) {
+		t.Errorf("expected MissingRequiredError of select, got: %v, %v", sql, err)
+	}
+	if sql, _, err := newQuery().CompileUpdate("events", map[string]interface{}{"status": "new"}); !isMissingRequired(err) {
+		t.Errorf("expected MissingRequiredError of update, got: %v, %v", sql, err)
+	}
+	if sql, _, err := newQuery().CompileDelete("events"); !isMissingRequired(err) {
+		t.Errorf("expected MissingRequiredError of delete, got: %v, %v", sql, err)
+	}
+}
+
+func isMissingRequired(err error) bool {
+	_, ok := err.(*MissingRequiredError)
+	return ok
+}
+
+func testClock() time.Time {
+	return time.Date(2020, time.May, 17, 10, 30, 0, 0, time.UTC)
+}
+
+func testOrders() *source.Source {
+	return &source.Source{
+		Cols: source.NewCols(
+			source.NewCol(source.TypeInteger, "id", "id", false),
+			source.NewCol(source.TypeEnum, "status", "status", false).WithValues("new", "paid"),
+			source.NewCol(source.TypeDecimal, "total", "total", false).WithScale(2).WithRole("manager", source.AllCapabilities),
+			source.NewCol(source.TypeString, "tags", "tags", true).WithStorage(source.StorageArray),
+			source.NewCol(source.TypeObject, "address", "addr", false).WithChildren(source.NewCols(
+				source.NewCol(source.TypeString, "city", "city", false),
+				source.NewCol(source.TypeString, "zip", "zip", false).WithDenied(source.Writable),
+			)),
+			source.NewCol(source.TypeString, "note", "", false).WithExpr("{q}.status || ' ' || {q}.id"),
+			source.NewCol(source.TypeNumber, "tenant", "tenant_id", false).WithHidden(),
+		),
+	}
+}
+
+var mutationCases = []struct {
+	Name        string
+	Target      string
+	Query       *Query
+	Assignments map[string]interface{} // delete if nil
+	Result      string
+	Args        []interface{}
+}{
+	{
+		Name:   "Update",
+		Target: "orders",
+		Query: &Query{
+			fields:    ast.NewIdentList(ast.NewIdent("id", 1), ast.NewIdent("status", 4)),
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 12), ast.NewConst("7", 15, token.INT), 14),
+			roles:     []string{"manager"},
+			source:    testOrders(),
+		},
+		Assignments: map[string]interface{}{
+			"status":  "paid",
+			"total":   10.5,
+			"tags":    []interface{}{"a", "b"},
+			"address": map[string]interface{}{"city": "Paris"},
+		},
+		Result: "update orders as q set addr = $1, status = $2, tags = array(select jsonb_array_elements_text($3::jsonb))::text[], total = $4 " +
+			"where q.id = 7 returning q.id, q.status",
+		Args: []interface{}{`{"city":"Paris"}`, "paid", `["a","b"]`, 10.5},
+	},
+	{
+		Name:   "Update in sqlite",
+		Target: "orders",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 1), ast.NewConst("new", 8, token.STRING), 7),
+			dialect:   SQLite,
+			source:    testOrders(),
+		},
+		Assignments: map[string]interface{}{"id": float64(8), "address": nil},
+		Result:      "update orders as q set addr = null, id = ? where q.status = 'new'",
+		Args:        []interface{}{int64(8)},
+	},
+	{
+		Name:   "Delete",
+		Target: "orders",
+		Query: &Query{
+			fields:    ast.NewIdentList(ast.NewIdent("id", 1)),
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 5), ast.NewConst("7", 8, token.INT), 7),
+			source:    testOrders(),
+		},
+		Result: "delete from orders as q where q.id = 7 returning q.id",
+	},
+	{
+		Name:   "Delete in sqlite",
+		Target: "orders",
+		Query: &Query{
+			fields:    ast.NewIdentList(ast.NewIdent("id", 1)),
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 5), ast.NewConst("new", 12, token.STRING), 11),
+			dialect:   SQLite,
+			source:    testOrders(),
+		},
+		Result: "delete from orders as q where q.status = 'new' returning orders.id",
+	},
+	{
+		Name:   "Bulk delete",
+		Target: "orders",
+		Query: &Query{
+			policy: ast.NewBinaryExpr(token.EQL, ast.NewIdent("tenant", 0), ast.NewConst("1", 0, token.INT), 0),
+			bulk:   true,
+			source: testOrders(),
+		},
+		Result: "delete from orders as q where q.tenant_id = 1",
+	},
+}
+
+func testVersionedOrders(t source.Datatype, name string) *source.Source {
+	s := testOrders()
+	s.Cols[name] = source.NewCol(t, name, name, false)
+	s.Version = name
+	return s
+}
+
+var versionCases = []struct {
+	Name        string
+	Query       *Query
+	Assignments map[string]interface{} // delete if nil
+	Result      string
+	Args        []interface{}
+}{
+	{
+		Name: "Update with version",
+		Query: (&Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewConst("7", 4, token.INT), 3),
+			source:    testVersionedOrders(source.TypeInteger, "version"),
+		}).WithVersion("3"),
+		Assignments: map[string]interface{}{"status": "paid"},
+		Result:      "update orders as q set status = $1, version = q.version + 1 where q.id = 7 and q.version = $2",
+		Args:        []interface{}{"paid", int64(3)},
+	},
+	{
+		Name: "Update of versioned source without expected version",
+		Query: &Query{
+			condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewConst("7", 4, token.INT), 3),
+			clock:     testClock,
+			source:    testVersionedOrders(source.TypeTime, "updated"),
+		},
+		Assignments: map[string]interface{}{"status": "paid"},
+		Result:      "update orders as q set status = $1, updated = '2020-05-17 10:30:00Z'::timestamptz where q.id = 7",
+		Args:        []interface{}{"paid"},
+	},
+	{
+		Name: "Delete with versions",
+		Query: (&Query{
+			condition: ast.NewBinaryExpr(
+				token.OR,
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewConst("7", 4, token.INT), 3),
+				ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 6), ast.NewConst("8", 9, token.INT), 8),
+				5,
+			),
+			source: testVersionedOrders(source.TypeTime, "updated"),
+		}).WithVersion("2020-05-17T10:30:00.123456Z", "2020-05-17T10:31:00Z"),
+		Result: "delete from orders as q where (q.id = 7 or q.id = 8) and q.updated in ($1, $2)",
+		Args:   []interface{}{"2020-05-17T10:30:00.123456Z", "2020-05-17T10:31:00Z"},
+	},
+}
+
+func testSoftDeletedOrders() *source.Source {
+	s := testVersionedOrders(source.TypeInteger, "version")
+	s.Cols["deleted"] = source.NewCol(source.TypeTime, "deleted", "deleted_at", false)
+	s.Deleted = "deleted"
+	return s
+}
+
+func TestCompileSoftDelete(t *testing.T) {
+	q := (&Query{clock: testClock, source: testSoftDeletedOrders()}).WithVersion("3")
+	q.RewriteCondition(testCondition())
+	sql, args, err := q.CompileDelete("orders")
+	if err != nil {
+		t.Errorf("expected err: %v, got: %v", nil, err)
+		t.FailNow()
+	}
+	expected := "update orders as q set deleted_at = '2020-05-17 10:30:00Z'::timestamptz, version = q.version + 1 " +
+		"where q.deleted_at is null and q.id = 7 and q.version = $1"
+	if sql != expected {
+		t.Errorf("expected: %v, got: %v", expected, sql)
+		t.Fail()
+	}
+	if expectedArgs := []interface{}{int64(3)}; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("expected args: %#v, got: %#v", expectedArgs, args)
+		t.Fail()
+	}
+
+	q = &Query{source: testSoftDeletedOrders()}
+	q.RewriteCondition(ast.NewIdent("$withDeleted", 1))
+	if sql, _, err := q.WithDeletedAllowed(true).CompileDelete("orders"); err != ErrUnfiltered {
+		t.Errorf("expected err: %v, got: %v, %v", ErrUnfiltered, sql, err)
+		t.Fail()
+	}
+}
+
+func TestCompileVersion(t *testing.T) {
+	for _, c := range versionCases {
+		t.Run(c.Name, func(t *testing.T) {
+			var sql string
+			var args []interface{}
+			var err error
+			if c.Assignments == nil {
+				sql, args, err = c.Query.CompileDelete("orders")
+			} else {
+				sql, args, err = c.Query.CompileUpdate("orders", c.Assignments)
+			}
+			if err != nil {
+				t.Errorf("expected err: %v, got: %v", nil, err)
+				t.FailNow()
+			}
+			if sql != c.Result {
+				t.Errorf("expected: %v, got: %v", c.Result, sql)
+				t.Fail()
+			}
+			if !reflect.DeepEqual(args, c.Args) {
+				t.Errorf("expected args: %#v, got: %#v", c.Args, args)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestCompileUpsertVersion(t *testing.T) {
+	q := (&Query{source: testVersionedOrders(source.TypeInteger, "version")}).WithUpsert([]string{"id"}, "status")
+	sql, args, err := q.CompileInsert("orders", map[string]interface{}{"id": 7.0, "status": "paid"})
+	if err != nil {
+		t.Errorf("expected err: %v, got: %v", nil, err)
+		t.FailNow()
+	}
+	expected := "insert into orders as q (id, status) values ($1, $2) on conflict (id) do update set status = excluded.status, version = q.version + 1"
+	if sql != expected {
+		t.Errorf("expected: %v, got: %v", expected, sql)
+		t.Fail()
+	}
+	if expectedArgs := []interface{}{int64(7), "paid"}; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("expected args: %#v, got: %#v", expectedArgs, args)
+		t.Fail()
+	}
+}
+
+func TestCompileVersionErrors(t *testing.T) {
+	q := (&Query{source: testVersionedOrders(source.TypeInteger, "version")}).WithVersion("3")
+	q.RewriteCondition(testCondition())
+	if sql, _, err := q.CompileUpdate("orders", map[string]interface{}{"version": 4.0}); err == nil {
+		t.Errorf("expected error of version assignment, got: %v", sql)
+		t.Fail()
+	}
+	if sql, _, err := q.WithVersion("W/3").CompileDelete("orders"); err == nil {
+		t.Errorf("expected error of version value, got: %v", sql)
+		t.Fail()
+	}
+}
+
+func TestCompileMutation(t *testing.T) {
+	for _, c := range mutationCases {
+		t.Run(c.Name, func(t *testing.T) {
+			var sql string
+			var args []interface{}
+			var err error
+			if c.Assignments == nil {
+				sql, args, err = c.Query.CompileDelete(c.Target)
+			} else {
+				sql, args, err = c.Query.CompileUpdate(c.Target, c.Assignments)
+			}
+			if err != nil {
+				t.Errorf("expected err: %v, got: %v", nil, err)
+				t.FailNow()
+			}
+			if sql != c.Result {
+				t.Errorf("expected: %v, got: %v", c.Result, sql)
+				t.Fail()
+			}
+			if !reflect.DeepEqual(args, c.Args) {
+				t.Errorf("expected args: %#v, got: %#v", c.Args, args)
+				t.Fail()
+			}
+		})
+	}
+}
+
+var mutationErrorCases = []struct {
+	Name        string
+	Query       *Query
+	Assignments map[string]interface{}
+}{
+	{Name: "Unknown column", Assignments: map[string]interface{}{"state": "new"}},
+	{Name: "Hidden column", Assignments: map[string]interface{}{"tenant": 2.0}},
+	{Name: "Computed column", Assignments: map[string]interface{}{"note": "x"}},
+	{Name: "Not writable child", Assignments: map[string]interface{}{"address": map[string]interface{}{"zip": "101000"}}},
+	{Name: "Unknown child", Assignments: map[string]interface{}{"address": map[string]interface{}{"street": "Main"}}},
+	{Name: "Value outside of enum", Assignments: map[string]interface{}{"status": "lost"}},
+	{Name: "Integer with fraction", Assignments: map[string]interface{}{"id": 7.5}},
+	{Name: "Decimal with greater scale", Query: &Query{roles: []string{"manager"}}, Assignments: map[string]interface{}{"total": 1.234}},
+	{Name: "Array element of other type", Assignments: map[string]interface{}{"tags": []interface{}{"a", 1.0}}},
+	{Name: "Not writable for role", Query: &Query{roles: []string{"clerk"}}, Assignments: map[string]interface{}{"total": 1.5}},
+	{Name: "Nothing to update", Assignments: map[string]interface{}{}},
+	{Name: "Limits", Query: &Query{limits: ast.NewLimitsStmt(nil, ast.NewConst("1", 0, token.INT))}},
+}
+
+func TestCompileMutationErrors(t *testing.T) {
+	for _, c := range mutationErrorCases {
+		t.Run(c.Name, func(t *testing.T) {
+			q := c.Query
+			if q == nil {
+				q = &Query{}
+			}
+			q.WithSource(testOrders()).RewriteCondition(ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewConst("7", 4, token.INT), 3))
+			var sql string
+			var err error
+			if c.Assignments == nil {
+				sql, _, err = q.CompileDelete("orders")
+			} else {
+				sql, _, err = q.CompileUpdate("orders", c.Assignments)
+			}
+			if err == nil {
+				t.Errorf("expected error, got: %v", sql)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestUnfiltered(t *testing.T) {
+	q := &Query{source: testOrders()}
+	if sql, _, err := q.CompileUpdate("orders", map[string]interface{}{"status": "new"}); err != ErrUnfiltered {
+		t.Errorf("expected err: %v, got: %v, %v", ErrUnfiltered, sql, err)
+		t.Fail()
+	}
+	q.WithAccess(DropDenied).WithRoles("clerk").RewriteCondition(
+		ast.NewBinaryExpr(token.GTR, ast.NewIdent("total", 1), ast.NewConst("100", 7, token.INT), 6),
+	)
+	if sql, _, err := q.CompileDelete("orders"); err != ErrUnfiltered {
+		t.Errorf("expected err: %v, got: %v, %v", ErrUnfiltered, sql, err)
+		t.Fail()
+	}
+}
+
+var insertCases = []struct {
+	Name   string
+	Query  *Query
+	Rows   interface{}
+	Result string
+	Args   []interface{}
+}{
+	{
+		Name:  "Insert",
+		Query: &Query{fields: ast.NewIdentList(ast.NewIdent("id", 1), ast.NewIdent("note", 4))},
+		Rows: map[string]interface{}{
+			"status":  "new",
+			"tags":    []interface{}{"a"},
+			"address": map[string]interface{}{"city": "Paris"},
+		},
+		Result: "insert into orders as q (addr, status, tags) values ($1, $2, array(select jsonb_array_elements_text($3::jsonb))::text[]) " +
+			`returning q.id, (q.status || ' ' || q.id) as "note"`,
+		Args: []interface{}{`{"city":"Paris"}`, "new", `["a"]`},
+	},
+	{
+		Name: "Batch insert",
+		Rows: []interface{}{
+			map[string]interface{}{"id": 1.0, "status": "new"},
+			map[string]interface{}{"id": 2.0},
+		},
+		Result: "insert into orders as q (id, status) values ($1, $2), ($3, default)",
+		Args:   []interface{}{int64(1), "new", int64(2)},
+	},
+	{
+		Name:   "Insert default values",
+		Rows:   map[string]interface{}{},
+		Result: "insert into orders as q default values",
+	},
+	{
+		Name:   "Upsert",
+		Query:  (&Query{}).WithUpsert([]string{"tenant", "id"}, "status", "address"),
+		Rows:   map[string]interface{}{"id": 1.0, "status": "paid"},
+		Result: "insert into orders as q (id, status) values ($1, $2) on conflict (tenant_id, id) do update set status = excluded.status, addr = excluded.addr",
+		Args:   []interface{}{int64(1), "paid"},
+	},
+	{
+		Name:   "Insert with policy",
+		Query:  (&Query{policy: ast.NewBinaryExpr(token.EQL, ast.NewIdent("tenant", 0), ast.NewConst("1", 0, token.INT), 0)}).WithUpsert([]string{"id"}, "status"),
+		Rows:   []interface{}{map[string]interface{}{"id": 1.0, "status": "paid"}, map[string]interface{}{"id": 2.0, "status": "new"}},
+		Result: "insert into orders as q (id, status, tenant_id) values ($1, $2, 1), ($3, $4, 1) on conflict (id) do update set status = excluded.status where q.tenant_id = 1",
+		Args:   []interface{}{int64(1), "paid", int64(2), "new"},
+	},
+	{
+		Name:   "Insert with value of policy",
+		Query:  &Query{policy: ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 0), ast.NewConst("new", 0, token.STRING), 0)},
+		Rows:   map[string]interface{}{"id": 1.0, "status": "new"},
+		Result: "insert into orders as q (id, status) values ($1, 'new')",
+		Args:   []interface{}{int64(1)},
+	},
+	{
+		Name:   "Insert in sqlite",
+		Query:  &Query{fields: ast.NewIdentList(ast.NewIdent("id", 1), ast.NewIdent("note", 4)), dialect: SQLite},
+		Rows:   map[string]interface{}{"id": 1.0, "status": "new"},
+		Result: `insert into orders as q (id, status) values (?, ?) returning orders.id, (orders.status || ' ' || orders.id) as "note"`,
+		Args:   []interface{}{int64(1), "new"},
+	},
+	{
+		Name:   "Upsert with do nothing in sqlite",
+		Query:  (&Query{dialect: SQLite}).WithUpsert([]string{"id"}),
+		Rows:   []interface{}{map[string]interface{}{"id": 1.0}, map[string]interface{}{"id": 2.0}},
+		Result: "insert into orders as q (id) values (?), (?) on conflict (id) do nothing",
+		Args:   []interface{}{int64(1), int64(2)},
+	},
+}
+
+func TestCompileInsert(t *testing.T) {
+	for _, c := range insertCases {
+		t.Run(c.Name, func(t *testing.T) {
+			q := c.Query
+			if q == nil {
+				q = &Query{}
+			}
+			sql, args, err := q.WithSource(testOrders()).CompileInsert("orders", c.Rows)
+			if err != nil {
+				t.Errorf("expected err: %v, got: %v", nil, err)
+				t.FailNow()
+			}
+			if sql != c.Result {
+				t.Errorf("expected: %v, got: %v", c.Result, sql)
+				t.Fail()
+			}
+			if !reflect.DeepEqual(args, c.Args) {
+				t.Errorf("expected args: %#v, got: %#v", c.Args, args)
+				t.Fail()
+			}
+		})
+	}
+}
+
+var insertErrorCases = []struct {
+	Name  string
+	Query *Query
+	Rows  interface{}
+}{
+	{Name: "Not object", Rows: "new"},
+	{Name: "Empty batch", Rows: []interface{}{}},
+	{Name: "Not object in batch", Rows: []interface{}{map[string]interface{}{"id": 1.0}, 2.0}},
+	{Name: "Unknown column", Rows: map[string]interface{}{"state": "new"}},
+	{Name: "Nested value of other type", Rows: map[string]interface{}{"address": map[string]interface{}{"city": 1.0}}},
+	{Name: "Invalid value in batch", Rows: []interface{}{map[string]interface{}{"id": 1.0}, map[string]interface{}{"id": "2"}}},
+	{Name: "Different columns in sqlite", Query: &Query{dialect: SQLite}, Rows: []interface{}{map[string]interface{}{"id": 1.0, "status": "new"}, map[string]interface{}{"id": 2.0}}},
+	{Name: "Empty rows of batch", Rows: []interface{}{map[string]interface{}{}, map[string]interface{}{}}},
+	{Name: "Unknown conflict key", Query: (&Query{}).WithUpsert([]string{"code"}), Rows: map[string]interface{}{"id": 1.0}},
+	{Name: "Upsert without keys", Query: (&Query{}).WithUpsert(nil, "status"), Rows: map[string]interface{}{"id": 1.0}},
+	{Name: "Upsert of not writable column", Query: (&Query{}).WithUpsert([]string{"id"}, "note"), Rows: map[string]interface{}{"id": 1.0}},
+	{
+		Name:  "Value contradicts policy",
+		Query: &Query{policy: ast.NewBinaryExpr(token.EQL, ast.NewIdent("status", 0), ast.NewConst("new", 0, token.STRING), 0)},
+		Rows:  map[string]interface{}{"id": 1.0, "status": "paid"},
+	},
+	{
+		Name: "Policy that can not be checked on insert",
+		Query: &Query{policy: ast.NewBinaryExpr(
+			token.OR,
+			ast.NewBinaryExpr(token.EQL, ast.NewIdent("tenant", 0), ast.NewConst("1", 0, token.INT), 0),
+			ast.NewBinaryExpr(token.EQL, ast.NewIdent("tenant", 0), ast.NewConst("2", 0, token.INT), 0),
+			0,
+		)},
+		Rows: map[string]interface{}{"id": 1.0},
+	},
+	{Name: "Condition", Query: &Query{condition: ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewConst("7", 4, token.INT), 3)}, Rows: map[string]interface{}{"id": 1.0}},
+}
+
+func TestCompileInsertErrors(t *testing.T) {
+	for _, c := range insertErrorCases {
+		t.Run(c.Name, func(t *testing.T) {
+			q := c.Query
+			if q == nil {
+				q = &Query{}
+			}
+			if sql, _, err := q.WithSource(testOrders()).CompileInsert("orders", c.Rows); err == nil {
+				t.Errorf("expected error, got: %v", sql)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func testCondition() ast.Expr {
+	return ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 1), ast.NewConst("7", 4, token.INT), 3)
+}
+
+var patchCases = []struct {
+	Name   string
+	Query  *Query
+	Merge  bool
+	Patch  interface{}
+	Result string
+	Args   []interface{}
+}{
+	{
+		Name:  "Merge patch",
+		Merge: true,
+		Patch: map[string]interface{}{
+			"status": "paid",
+			"address": map[string]interface{}{
+				"city":     "Paris",
+				"geo":      map[string]interface{}{"lat": 48.8},
+				"building": nil,
+			},
+		},
+		Result: "update orders as q set addr = jsonb_set(jsonb_set((coalesce(q.addr::jsonb, '{}') #- '{building}'), '{city}', $1::jsonb), '{geo}', " +
+			"jsonb_set(coalesce((q.addr::jsonb -> 'geo'), '{}'), '{lat}', $2::jsonb)), status = $3 where q.id = 7",
+		Args: []interface{}{`"Paris"`, "48.8", "paid"},
+	},
+	{
+		Name:   "Merge patch of scalars in sqlite",
+		Query:  &Query{dialect: SQLite},
+		Merge:  true,
+		Patch:  map[string]interface{}{"status": "new", "address": nil},
+		Result: "update orders as q set addr = null, status = ? where q.id = 7",
+		Args:   []interface{}{"new"},
+	},
+	{
+		Name: "JSON patch",
+		Patch: []interface{}{
+			map[string]interface{}{"op": "replace", "path": "/address/city", "value": "Paris"},
+			map[string]interface{}{"op": "remove", "path": "/address/geo/lat"},
+			map[string]interface{}{"op": "add", "path": "/items/-", "value": map[string]interface{}{"sku": "a1"}},
+			map[string]interface{}{"op": "remove", "path": "/items/0"},
+			map[string]interface{}{"op": "replace", "path": "/items/1/sku", "value": "b2"},
+			map[string]interface{}{"op": "add", "path": "/tags/-", "value": "new"},
+			map[string]interface{}{"op": "remove", "path": "/tags/2"},
+			map[string]interface{}{"op": "replace", "path": "/status", "value": "paid"},
+		},
+		Result: "update orders as q set " +
+			"addr = (jsonb_set(coalesce(q.addr::jsonb, '{}'), '{city}', $1::jsonb, false) #- '{geo,lat}'), " +
+			"items = jsonb_set((jsonb_insert(coalesce(q.items::jsonb, '[]'), '{-1}', $2::jsonb, true) #- '{0}'), '{1,sku}', $3::jsonb, false), " +
+			"status = $5, " +
+			"tags = (array_append(q.tags, $4::text))[:2] || (array_append(q.tags, $4::text))[4:] " +
+			"where q.id = 7 and (coalesce(q.addr::jsonb, '{}') #> '{city}') is not null " +
+			"and (jsonb_set(coalesce(q.addr::jsonb, '{}'), '{city}', $1::jsonb, false) #> '{geo,lat}') is not null " +
+			"and (jsonb_insert(coalesce(q.items::jsonb, '[]'), '{-1}', $2::jsonb, true) #> '{0}') is not null " +
+			"and ((jsonb_insert(coalesce(q.items::jsonb, '[]'), '{-1}', $2::jsonb, true) #- '{0}') #> '{1,sku}') is not null " +
+			"and cardinality(array_append(q.tags, $4::text)) > 2",
+		Args: []interface{}{`"Paris"`, `{"sku":"a1"}`, `"b2"`, "new", "paid"},
+	},
+	{
+		Name: "JSON patch of whole column",
+		Patch: []interface{}{
+			map[string]interface{}{"op": "remove", "path": "/address"},
+			map[string]interface{}{"op": "add", "path": "/address/city", "value": "Paris"},
+			map[string]interface{}{"op": "add", "path": "/tags/0", "value": "first"},
+		},
+		Result: "update orders as q set addr = jsonb_set(coalesce(null::jsonb, '{}'), '{city}', $1::jsonb), " +
+			"tags = (q.tags)[:0] || $2::text || (q.tags)[1:] where q.id = 7",
+		Args: []interface{}{`"Paris"`, "first"},
+	},
+	{
+		Name: "JSON patch with test",
+		Patch: []interface{}{
+			map[string]interface{}{"op": "test", "path": "/status", "value": "new"},
+			map[string]interface{}{"op": "test", "path": "/address/city", "value": "Oslo"},
+			map[string]interface{}{"op": "test", "path": "/tags/0", "value": "a"},
+			map[string]interface{}{"op": "replace", "path": "/status", "value": "paid"},
+			map[string]interface{}{"op": "test", "path": "/status", "value": "paid"},
+		},
+		Result: "update orders as q set status = $4 where q.id = 7 and q.status = $1 and (coalesce(q.addr::jsonb, '{}') #> '{city}') = $2::jsonb " +
+			"and (q.tags)[1] = $3::text and $4 = $5",
+		Args: []interface{}{"new", `"Oslo"`, "a", "paid", "paid"},
+	},
+}
+
+func testPatchOrders() *source.Source {
+	s := testOrders()
+	s.Cols["address"].Children["geo"] = source.NewCol(source.TypeObject, "geo", "geo", false).WithChildren(source.NewCols(
+		source.NewCol(source.TypeNumber, "lat", "lat", false),
+	))
+	s.Cols["address"].Children["building"] = source.NewCol(source.TypeString, "building", "building", false)
+	s.Cols["address"].Children["code"] = source.NewCol(source.TypeString, "code", "code", false).WithDenied(source.Filterable)
+	s.Cols["items"] = source.NewCol(source.TypeObject, "items", "items", true).WithChildren(source.NewCols(
+		source.NewCol(source.TypeString, "sku", "sku", false),
+	))
+	return s
+}
+
+func TestCompilePatch(t *testing.T) {
+	for _, c := range patchCases {
+		t.Run(c.Name, func(t *testing.T) {
+			q := c.Query
+			if q == nil {
+				q = &Query{}
+			}
+			q.WithSource(testPatchOrders()).RewriteCondition(testCondition())
+			var sql string
+			var args []interface{}
+			var err error
+			if c.Merge {
+				sql, args, err = q.CompileMergePatch("orders", c.Patch)
+			} else {
+				sql, args, err = q.CompileJSONPatch("orders", c.Patch)
+			}
+			if err != nil {
+				t.Errorf("expected err: %v, got: %v", nil, err)
+				t.FailNow()
+			}
+			if sql != c.Result {
+				t.Errorf("expected: %v, got: %v", c.Result, sql)
+				t.Fail()
+			}
+			if !reflect.DeepEqual(args, c.Args) {
+				t.Errorf("expected args: %#v, got: %#v", c.Args, args)
+				t.Fail()
+			}
+		})
+	}
+}
+
+var patchErrorCases = []struct {
+	Name  string
+	Query *Query
+	Merge bool
+	Patch interface{}
+}{
+	{Name: "Merge patch of not object", Merge: true, Patch: []interface{}{}},
+	{Name: "Merge patch of unknown child", Merge: true, Patch: map[string]interface{}{"address": map[string]interface{}{"street": "Main"}}},
+	{Name: "Merge patch of not writable child", Merge: true, Patch: map[string]interface{}{"address": map[string]interface{}{"zip": nil}}},
+	{Name: "Merge patch of child with other type", Merge: true, Patch: map[string]interface{}{"address": map[string]interface{}{"geo": map[string]interface{}{"lat": "north"}}}},
+	{Name: "Merge patch of object in sqlite", Query: &Query{dialect: SQLite}, Merge: true, Patch: map[string]interface{}{"address": map[string]interface{}{"city": "Paris"}}},
+	{Name: "JSON patch of not array", Patch: map[string]interface{}{}},
+	{Name: "Unsupported operation", Patch: []interface{}{map[string]interface{}{"op": "move", "from": "/status", "path": "/note"}}},
+	{Name: "Unknown operation", Patch: []interface{}{map[string]interface{}{"op": "merge", "path": "/status", "value": "new"}}},
+	{Name: "Test only", Patch: []interface{}{map[string]interface{}{"op": "test", "path": "/status", "value": "new"}}},
+	{Name: "Test of not filterable child", Patch: []interface{}{
+		map[string]interface{}{"op": "test", "path": "/address/code", "value": "x"},
+		map[string]interface{}{"op": "replace", "path": "/status", "value": "new"},
+	}},
+	{Name: "Test of value with other type", Patch: []interface{}{
+		map[string]interface{}{"op": "test", "path": "/address/city", "value": 1.0},
+		map[string]interface{}{"op": "replace", "path": "/status", "value": "new"},
+	}},
+	{Name: "Operation without value", Patch: []interface{}{map[string]interface{}{"op": "add", "path": "/status"}}},
+	{Name: "Path is not pointer", Patch: []interface{}{map[string]interface{}{"op": "remove", "path": "status"}}},
+	{Name: "Path through scalar", Patch: []interface{}{map[string]interface{}{"op": "remove", "path": "/status/a"}}},
+	{Name: "Key of array", Patch: []interface{}{map[string]interface{}{"op": "remove", "path": "/items/sku"}}},
+	{Name: "Append by remove", Patch: []interface{}{map[string]interface{}{"op": "remove", "path": "/tags/-"}}},
+	{Name: "Element of other type", Patch: []interface{}{map[string]interface{}{"op": "add", "path": "/items/-", "value": "a1"}}},
+	{Name: "Null element of native array", Patch: []interface{}{map[string]interface{}{"op": "add", "path": "/tags/0", "value": nil}}},
+	{Name: "JSON patch in sqlite", Query: &Query{dialect: SQLite}, Patch: []interface{}{map[string]interface{}{"op": "remove", "path": "/address/city"}}},
+}
+
+func TestCompilePatchErrors(t *testing.T) {
+	for _, c := range patchErrorCases {
+		t.Run(c.Name, func(t *testing.T) {
+			q := c.Query
+			if q == nil {
+				q = &Query{}
+			}
+			q.WithSource(testPatchOrders()).RewriteCondition(testCondition())
+			var sql string
+			var err error
+			if c.Merge {
+				sql, _, err = q.CompileMergePatch("orders", c.Patch)
+			} else {
+				sql, _, err = q.CompileJSONPatch("orders", c.Patch)
+			}
+			if err == nil {
+				t.Errorf("expected error, got: %v", sql)
 				t.Fail()
 			}
 		})
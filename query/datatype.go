@@ -0,0 +1,119 @@
+package query
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+// isNumeric returns true if datatype is a number
+func isNumeric(t source.Datatype) bool {
+	return t == source.TypeNumber || t == source.TypeInteger || t == source.TypeDecimal
+}
+
+// compileTypedConst returns constant validated against integer, decimal, date, uuid, enum, interval or json column
+func (q *Query) compileTypedConst(column *source.Col, expr *ast.Const) (string, error) {
+	t := expr.Token()
+	switch column.Type {
+	case source.TypeInteger:
+		if t != token.INT {
+			return "", q.mustBe(expr.Value, "integer", t.String(), expr.Pos())
+		}
+	case source.TypeDecimal:
+		if t != token.INT && t != token.FLOAT {
+			return "", q.mustBe(expr.Value, "decimal", t.String(), expr.Pos())
+		}
+		if i := strings.IndexByte(expr.Value, '.'); column.Scale > 0 && i >= 0 && len(expr.Value)-i-1 > column.Scale {
+			return "", q.mustBe(expr.Value, "decimal with scale "+strconv.Itoa(column.Scale), "more digits", expr.Pos())
+		}
+	case source.TypeDate:
+		if t != token.STRING {
+			return "", q.mustBe(expr.Value, "date", t.String(), expr.Pos())
+		}
+		if _, err := time.Parse("2006-01-02", expr.Value); err != nil {
+			return "", q.mustBe(expr.Value, "date like 2006-01-02", "string", expr.Pos())
+		}
+	case source.TypeUUID:
+		if t != token.STRING || !isUUID(expr.Value) {
+			return "", q.mustBe(expr.Value, "uuid", t.String(), expr.Pos())
+		}
+	case source.TypeEnum:
+		if t != token.STRING || !hasValue(column.Values, expr.Value) {
+			return "", q.mustBe(expr.Value, "one of "+strings.Join(column.Values, ", "), t.String(), expr.Pos())
+		}
+	case source.TypeInterval:
+		if t == token.INTERVAL {
+			return q.compileInterval(expr)
+		}
+		if t != token.STRING {
+			return "", q.mustBe(expr.Value, "interval", t.String(), expr.Pos())
+		}
+	case source.TypeJSON:
+		if t != token.STRING || !json.Valid([]byte(expr.Value)) {
+			return "", q.mustBe(expr.Value, "json", t.String(), expr.Pos())
+		}
+	default:
+		return "", q.mustBe(expr.Value, column.Name+" value", t.String(), expr.Pos())
+	}
+	return q.compileConst(expr)
+}
+
+// castValue returns constant of date, uuid or decimal column with cast in postgres, other constants as is
+func (q *Query) castValue(column *source.Col, compiled string) string {
+	if q.dialect != Postgres || column.IsArray {
+		return compiled
+	}
+	switch column.Type {
+	case source.TypeDate, source.TypeUUID, source.TypeDecimal:
+		return compiled + "::" + q.compileType(column.Type)
+	default:
+		return compiled
+	}
+}
+
+// compileInterval returns interval constant like 7d as sql
+func (q *Query) compileInterval(expr *ast.Const) (string, error) {
+	n, unit := expr.Value[:len(expr.Value)-1], intervalUnits[expr.Value[len(expr.Value)-1]]
+	if unit == "" {
+		return "", q.unexpect(expr.Token(), expr.Pos())
+	}
+	if q.dialect == SQLite {
+		return "'" + n + " " + unit + "'", nil
+	}
+	return "interval '" + n + " " + unit + "'", nil
+}
+
+// isUUID returns true if s looks like 123e4567-e89b-12d3-a456-426614174000
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, ch := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if ch != '-' {
+				return false
+			}
+		default:
+			if !(ch >= '0' && ch <= '9') && !(ch >= 'a' && ch <= 'f') && !(ch >= 'A' && ch <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasValue returns true if values contain v
+func hasValue(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package query
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+)
+
+// compileEmbedded returns JSON of related rows for embedded field like customer(name,email)
+// and lateral join that selects it: object for one-to-one relation and array of objects otherwise
+func (q *Query) compileEmbedded(field *ast.Ident) (string, string, error) {
+	if q.dialect != Postgres {
+		return "", "", errors.New("embedded fields are supported in postgres only")
+	}
+	rel, err := q.relation(field)
+	if err != nil {
+		return "", "", err
+	}
+	if field.Fields == nil || len(*field.Fields) == 0 {
+		return "", "", q.mustBe(field.Name, "embedded with fields", "empty", field.Pos())
+	}
+	sub := q.subquery(rel, nil)
+	pairs := make([]string, 0, len(*field.Fields))
+	var joins []string
+	for _, f := range *field.Fields {
+		var compiled string
+		if f.Fields == nil && q.dropped(rel.Source.Cols, f.Name, source.Selectable) {
+			continue
+		}
+		if f.Fields != nil {
+			var join string
+			compiled, join, err = sub.compileEmbedded(f)
+			joins = append(joins, join)
+		} else if rel.Source.Cols.Path(f.Name) == nil {
+			err = q.notDefined(field.Name+"."+f.Name, f.Pos())
+		} else if err = q.checkAllowed(rel.Source.Cols, f.Name, source.Selectable, f.Pos()); err == nil {
+			compiled, err = sub.compileColumnPath(f.Name, f.Pos())
+		}
+		if err != nil {
+			return "", "", err
+		}
+		pairs = append(pairs, "'"+f.Name+"', "+compiled)
+	}
+	from, where, err := q.compileRelated(rel, sub, field.Pos())
+	if err != nil {
+		return "", "", err
+	}
+	if len(joins) > 0 {
+		from += " " + strings.Join(joins, " ")
+	}
+	if where != "" {
+		where = " where " + where
+	}
+
+	object := "json_build_object(" + strings.Join(pairs, ", ") + ")"
+	var compiled string
+	if rel.Kind == source.OneToOne {
+		compiled = "select " + object + " data from " + from + where + " limit 1"
+	} else {
+		compiled = "select coalesce(json_agg(" + object + "), '[]') data from " + from + where
+	}
+	alias := `"` + field.Name + `"`
+	return alias + ".data", "left join lateral (" + compiled + ") " + alias + " on true", nil
+}
@@ -0,0 +1,273 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+// upsert contains unique keys that detect conflicts of insert and columns updated on conflict
+type upsert struct {
+	keys []string
+	cols []string
+}
+
+// WithUpsert makes insert update columns of rows that conflict by unique keys, e.g. WithUpsert([]string{"id"}, "status").
+// Conflicting rows are skipped if columns are not set
+func (q *Query) WithUpsert(keys []string, cols ...string) *Query {
+	q.upsert = &upsert{keys: keys, cols: cols}
+	return q
+}
+
+// CompileInsert returns insert into target and its arguments. Rows are decoded JSON: an object
+// or an array of objects by names of columns, selected fields are returned.
+// Columns compared by = in policy are inserted with values of policy
+func (q *Query) CompileInsert(target string, rows interface{}) (string, []interface{}, error) {
+	if q.source == nil {
+		return "", nil, errors.New("source is not defined")
+	}
+	if q.condition != nil {
+		return "", nil, errors.New("condition is not allowed for insert")
+	}
+	objects, err := jsonObjects(rows)
+	if err != nil {
+		return "", nil, err
+	}
+	fixed := map[string]ast.Expr{}
+	if err := q.collectPolicyValues(q.policy, fixed); err != nil {
+		return "", nil, err
+	}
+
+	set := map[string]bool{}
+	for name := range fixed {
+		set[name] = true
+	}
+	for _, object := range objects {
+		for name := range object {
+			set[name] = true
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cols := make([]*source.Col, len(names))
+	dbNames := make([]string, len(names))
+	for i, name := range names {
+		if fixed[name] != nil {
+			cols[i] = q.source.Cols[name]
+		} else if cols[i], err = q.writableColumn(q.source.Cols, name, name); err != nil {
+			return "", nil, err
+		}
+		dbNames[i] = cols[i].DBName
+	}
+
+	parts := []string{"insert into", target + " as " + q.tableAlias()}
+	p := &params{dialect: q.dialect}
+	if len(names) == 0 {
+		if len(objects) > 1 {
+			return "", nil, errors.New("rows of batch insert must have columns")
+		}
+		parts = append(parts, "default values")
+	} else {
+		values := make([]string, len(objects))
+		for i, object := range objects {
+			compiled, err := q.compileRow(object, names, cols, fixed, p)
+			if err != nil {
+				if len(objects) > 1 {
+					return "", nil, fmt.Errorf("rows[%d]: %v", i, err)
+				}
+				return "", nil, err
+			}
+			values[i] = "(" + compiled + ")"
+		}
+		parts = append(parts, "("+strings.Join(dbNames, ", ")+")", "values", strings.Join(values, ", "))
+	}
+
+	if q.upsert != nil {
+		conflict, err := q.compileConflict()
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, conflict)
+	}
+	returning, err := q.compileReturning(target)
+	if err != nil {
+		return "", nil, err
+	}
+	if returning != "" {
+		parts = append(parts, "returning", returning)
+	}
+	return strings.Join(parts, " "), p.args, nil
+}
+
+// jsonObjects returns objects of decoded JSON object or array of objects
+func jsonObjects(rows interface{}) ([]map[string]interface{}, error) {
+	switch typedRows := rows.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{typedRows}, nil
+	case []interface{}:
+		if len(typedRows) == 0 {
+			return nil, errors.New("nothing to insert")
+		}
+		objects := make([]map[string]interface{}, len(typedRows))
+		for i, row := range typedRows {
+			object, ok := row.(map[string]interface{})
+			if !ok {
+				return nil, valueMustBe(fmt.Sprintf("rows[%d]", i), "object", row)
+			}
+			objects[i] = object
+		}
+		return objects, nil
+	default:
+		return nil, valueMustBe("rows", "object or array of objects", rows)
+	}
+}
+
+// collectPolicyValues collects values of columns compared by = in top-level and-chain of policy,
+// they are inserted instead of values of rows. Returns error if policy has other predicates,
+// because they can not be checked on insert
+func (q *Query) collectPolicyValues(expr ast.Expr, fixed map[string]ast.Expr) error {
+	if expr == nil {
+		return nil
+	}
+	if binaryExpr, ok := expr.(*ast.BinaryExpr); ok {
+		switch binaryExpr.Op {
+		case token.AND:
+			if err := q.collectPolicyValues(binaryExpr.X, fixed); err != nil {
+				return err
+			}
+			return q.collectPolicyValues(binaryExpr.Y, fixed)
+		case token.EQL:
+			if x, ok := binaryExpr.X.(*ast.Ident); ok && policyLiteral(binaryExpr.Y) != "" {
+				column := q.source.Cols[x.Name]
+				if column != nil && column.Expr == "" && column.Storage != source.StorageTable {
+					fixed[x.Name] = binaryExpr.Y
+					return nil
+				}
+			}
+		}
+	}
+	return errors.New("policy of insert must compare columns with values by = joined by &")
+}
+
+// policyLiteral returns text of constant, negative number, true or false of policy, empty string for other expressions
+func policyLiteral(expr ast.Expr) string {
+	switch typedExpr := expr.(type) {
+	case *ast.Const:
+		return typedExpr.Value
+	case *ast.UnaryExpr:
+		if c, ok := typedExpr.X.(*ast.Const); ok && typedExpr.Op == token.MINUS && (c.Token() == token.INT || c.Token() == token.FLOAT) {
+			return "-" + c.Value
+		}
+	case *ast.Ident:
+		if typedExpr.Name == "true" || typedExpr.Name == "false" {
+			return typedExpr.Name
+		}
+	}
+	return ""
+}
+
+// matchesPolicy returns true if decoded JSON value is equal to value of policy
+func matchesPolicy(value interface{}, expr ast.Expr) bool {
+	literal := policyLiteral(expr)
+	switch typedValue := value.(type) {
+	case bool:
+		return strconv.FormatBool(typedValue) == literal
+	case string:
+		return typedValue == literal
+	case float64, json.Number:
+		n, err := strconv.ParseFloat(fmt.Sprint(typedValue), 64)
+		expected, errExpected := strconv.ParseFloat(literal, 64)
+		return err == nil && errExpected == nil && n == expected
+	}
+	return false
+}
+
+// compileRow returns values of object for columns, missing values are default in postgres.
+// Values of columns fixed by policy are taken from it, values of object must be equal to them
+func (q *Query) compileRow(object map[string]interface{}, names []string, cols []*source.Col, fixed map[string]ast.Expr, p *params) (string, error) {
+	compiled := make([]string, len(names))
+	for i, name := range names {
+		value, ok := object[name]
+		if expr := fixed[name]; expr != nil {
+			if ok && !matchesPolicy(value, expr) {
+				return "", fmt.Errorf("%v must be %v by policy", name, policyLiteral(expr))
+			}
+			literal, err := q.compileValue(cols[i], expr)
+			if err != nil {
+				return "", err
+			}
+			compiled[i] = q.castValue(cols[i], literal)
+			continue
+		}
+		if !ok {
+			if q.dialect == SQLite {
+				return "", fmt.Errorf("%v is missing, rows of batch insert must have the same columns in sqlite", name)
+			}
+			compiled[i] = "default"
+			continue
+		}
+		if err := q.checkJSONValue(cols[i], name, value, false); err != nil {
+			return "", err
+		}
+		param, err := q.compileParam(cols[i], value, p)
+		if err != nil {
+			return "", err
+		}
+		compiled[i] = param
+	}
+	return strings.Join(compiled, ", "), nil
+}
+
+// compileConflict returns on conflict clause of upsert, version column of updated rows is changed too
+func (q *Query) compileConflict() (string, error) {
+	if len(q.upsert.keys) == 0 {
+		return "", errors.New("conflict keys of upsert are not declared")
+	}
+	keys := make([]string, len(q.upsert.keys))
+	for i, name := range q.upsert.keys {
+		column := q.source.Cols[name]
+		if column == nil || column.Expr != "" || column.Storage == source.StorageTable {
+			return "", fmt.Errorf("conflict key %v is not defined", name)
+		}
+		keys[i] = column.DBName
+	}
+	conflict := "on conflict (" + strings.Join(keys, ", ") + ")"
+	if len(q.upsert.cols) == 0 {
+		return conflict + " do nothing", nil
+	}
+	sets := make([]string, len(q.upsert.cols))
+	for i, name := range q.upsert.cols {
+		column, err := q.writableColumn(q.source.Cols, name, name)
+		if err != nil {
+			return "", err
+		}
+		sets[i] = column.DBName + " = excluded." + column.DBName
+	}
+	bump, err := q.compileVersionBump()
+	if err != nil {
+		return "", err
+	}
+	if bump != "" {
+		sets = append(sets, bump)
+	}
+	conflict += " do update set " + strings.Join(sets, ", ")
+	if q.policy != nil {
+		// conflicting rows of other tenants and so on are not updated
+		where, _, err := q.compileExpr(q.policy)
+		if err != nil {
+			return "", err
+		}
+		conflict += " where " + where
+	}
+	return conflict, nil
+}
@@ -0,0 +1,178 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+// isNull returns true if expression is null
+func isNull(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "null"
+}
+
+// jsonPathOf returns SQL/JSON path like $.b[*].c for columns chain,
+// arrayBase must be true if chain starts in the array
+func jsonPathOf(chain []*source.Col, arrayBase bool) string {
+	path := "$"
+	if arrayBase {
+		path += "[*]"
+	}
+	for i, col := range chain {
+		path += "." + col.DBName
+		if col.IsArray && i < len(chain)-1 {
+			path += "[*]"
+		}
+	}
+	return path
+}
+
+// hasNestedArray returns true if any column in chain except last is array
+func hasNestedArray(chain []*source.Col) bool {
+	for _, col := range chain[:len(chain)-1] {
+		if col.IsArray {
+			return true
+		}
+	}
+	return false
+}
+
+// keysOf returns db names of columns chain joined by comma, e.g. b,c
+func keysOf(chain []*source.Col) string {
+	keys := make([]string, len(chain))
+	for i, col := range chain {
+		keys[i] = col.DBName
+	}
+	return strings.Join(keys, ",")
+}
+
+// compileColumnPath returns column by name or, for dotted name like a.b.c,
+// path inside object column casted to datatype of last column.
+// Subquery refers to column of outer query by $outer.name only
+func (q *Query) compileColumnPath(name string, pos token.Pos) (string, error) {
+	if strings.HasPrefix(name, pseudoOuter) {
+		if q.parent == nil {
+			return "", q.notDefined(name, pos)
+		}
+		return q.parent.compileOuterColumnPath(strings.TrimPrefix(name, pseudoOuter), pos)
+	}
+	chain := q.source.Cols.Path(name)
+	if chain == nil {
+		return "", q.notDefined(name, pos)
+	}
+	root := chain[0]
+	if root.Storage == source.StorageTable {
+		return "", q.mustBe(name, "column of table", "stored in child table "+root.Child.Table, pos)
+	}
+	if len(chain) == 1 {
+		return q.compileColumn(root), nil
+	}
+	for _, col := range chain[:len(chain)-1] {
+		if col.Type != source.TypeObject && col.Type != source.TypeJSON {
+			return "", q.mustBe(col.Name, "object", "any", pos)
+		}
+		if col.IsArray {
+			return "", q.mustBe(name, "path through objects", "path through array "+col.Name+" (use {...} instead)", pos)
+		}
+	}
+	leaf := chain[len(chain)-1]
+	if leaf.IsArray || leaf.Type == source.TypeObject || leaf.Type == source.TypeJSON {
+		return "(" + q.compileColumn(root) + " #> '{" + keysOf(chain[1:]) + "}')", nil
+	}
+	return "(" + q.compileColumn(root) + " #>> '{" + keysOf(chain[1:]) + "}')::" + q.compileType(leaf.Type), nil
+}
+
+// compileOuterColumnPath returns column of q referred by its subquery, column must be filterable
+func (q *Query) compileOuterColumnPath(name string, pos token.Pos) (string, error) {
+	if q.source.Cols.Path(name) == nil {
+		return "", q.notDefined(pseudoOuter+name, pos)
+	}
+	if err := q.checkAllowed(q.source.Cols, name, source.Filterable, pos); err != nil {
+		return "", err
+	}
+	return q.compileColumnPath(name, pos)
+}
+
+// compileColumn returns column of table or expression of computed column
+func (q *Query) compileColumn(col *source.Col) string {
+	if col.Expr != "" {
+		return "(" + strings.Replace(col.Expr, "{q}", q.tableAlias(), -1) + ")"
+	}
+	return q.tableAlias() + "." + col.DBName
+}
+
+// compileHas returns check that column is not SQL NULL or JSON key exists.
+// If parent is nil, argument of has is resolved in source columns,
+// otherwise in children of parent and base is a JSON document of parent
+func (q *Query) compileHas(expr *ast.CallExpr, parent *source.Col, base string) (string, error) {
+	if len(expr.Args) != 1 {
+		return "", q.mustBe(expr.Func.Name, "called with 1 argument", fmt.Sprint(len(expr.Args)), expr.Pos())
+	}
+	ident, ok := expr.Args[0].(*ast.Ident)
+	if !ok {
+		return "", q.unexpect(expr.Args[0].Token(), expr.Args[0].Pos())
+	}
+	cols := q.source.Cols
+	if parent != nil {
+		cols = parent.Children
+	}
+	chain := cols.Path(ident.Name)
+	if chain == nil {
+		return "", q.notDefined(ident.Name, ident.Pos())
+	}
+	if parent != nil {
+		if err := q.checkChain(chain, parent.Name+"."+ident.Name, source.Filterable, ident.Pos()); err != nil {
+			return "", err
+		}
+	}
+	arrayBase := false
+	if parent == nil && chain[0].Storage == source.StorageTable {
+		if len(chain) > 1 {
+			return "", q.mustBe(ident.Name, "column of table", "stored in child table "+chain[0].Child.Table, ident.Pos())
+		}
+		return q.compileExistsRelated(ident, nil)
+	}
+	if parent == nil {
+		if len(chain) == 1 {
+			return q.compileColumn(chain[0]) + " is not null", nil
+		}
+		base, arrayBase, chain = q.compileColumn(chain[0])+"::jsonb", chain[0].IsArray, chain[1:]
+	}
+	if len(chain) == 1 && !arrayBase {
+		return base + " ? '" + chain[0].DBName + "'", nil
+	}
+	return "jsonb_path_exists(" + base + ", '" + jsonPathOf(chain, arrayBase) + "')", nil
+}
+
+// compileJSONNull returns check that JSON value by columns chain is (or is not) JSON null
+func (q *Query) compileJSONNull(op token.Token, chain []*source.Col, base string, arrayBase bool, pos token.Pos) (string, error) {
+	var compiledOp, pathOp string
+	switch op {
+	case token.EQL:
+		compiledOp, pathOp = "=", "=="
+	case token.NEQ:
+		compiledOp, pathOp = "!=", "!="
+	default:
+		return "", q.mustBe(op.String(), "= or !=", "any", pos)
+	}
+	if !arrayBase && !hasNestedArray(chain) {
+		return base + " #> '{" + keysOf(chain) + "}' " + compiledOp + " 'null'::jsonb", nil
+	}
+	return "jsonb_path_exists(" + base + ", '" + jsonPathOf(chain, arrayBase) + " ? (@ " + pathOp + " null)')", nil
+}
+
+// compileJSONNullIdent returns check that JSON value by dotted identifier like a.b is (or is not) JSON null
+func (q *Query) compileJSONNullIdent(op token.Token, ident *ast.Ident) (string, error) {
+	chain := q.source.Cols.Path(ident.Name)
+	if chain == nil {
+		return "", q.notDefined(ident.Name, ident.Pos())
+	}
+	if chain[0].Type != source.TypeObject && chain[0].Type != source.TypeJSON {
+		return "", q.mustBe(chain[0].Name, "object", "any", ident.Pos())
+	}
+	return q.compileJSONNull(op, chain[1:], q.compileColumn(chain[0])+"::jsonb", chain[0].IsArray, ident.Pos())
+}
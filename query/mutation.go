@@ -0,0 +1,173 @@
+package query
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/token"
+)
+
+// ErrUnfiltered is returned if update or delete has no condition and bulk mutations are not allowed
+var ErrUnfiltered = errors.New("update or delete without condition is not allowed")
+
+// WithBulk allows update and delete without condition, they are refused by default
+func (q *Query) WithBulk(allowed bool) *Query {
+	q.bulk = allowed
+	return q
+}
+
+// CompileUpdate returns update of rows of target that match condition and its arguments.
+// Assignments are decoded JSON values by names of columns, selected fields are returned
+func (q *Query) CompileUpdate(target string, assignments map[string]interface{}) (string, []interface{}, error) {
+	if q.source == nil {
+		return "", nil, errors.New("source is not defined")
+	}
+	if len(assignments) == 0 {
+		return "", nil, errors.New("nothing to update")
+	}
+	if err := q.checkMutation(); err != nil {
+		return "", nil, err
+	}
+
+	names := sortedKeys(assignments)
+	p := &params{dialect: q.dialect}
+	sets := make([]string, len(names))
+	for i, name := range names {
+		column, err := q.writableColumn(q.source.Cols, name, name)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := q.checkJSONValue(column, name, assignments[name], false); err != nil {
+			return "", nil, err
+		}
+		compiled, err := q.compileParam(column, assignments[name], p)
+		if err != nil {
+			return "", nil, err
+		}
+		sets[i] = column.DBName + " = " + compiled
+	}
+	return q.compileUpdate(target, sets, p)
+}
+
+// compileUpdate returns update of target with compiled assignments like a = $1 and arguments of p,
+// version column of source is changed too. Guards are joined with condition by and
+func (q *Query) compileUpdate(target string, sets []string, p *params, guards ...string) (string, []interface{}, error) {
+	bump, err := q.compileVersionBump()
+	if err != nil {
+		return "", nil, err
+	}
+	if bump != "" {
+		sets = append(sets, bump)
+	}
+	parts := []string{"update", target + " as " + q.tableAlias(), "set", strings.Join(sets, ", ")}
+	parts, err = q.appendMutationTail(target, parts, p, guards...)
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.Join(parts, " "), p.args, nil
+}
+
+// CompileDelete returns delete of rows of target that match condition and its arguments,
+// selected fields are returned. If source has soft delete, rows are updated with current time instead
+func (q *Query) CompileDelete(target string) (string, []interface{}, error) {
+	if q.source == nil {
+		return "", nil, errors.New("source is not defined")
+	}
+	if err := q.checkMutation(); err != nil {
+		return "", nil, err
+	}
+	p := &params{dialect: q.dialect}
+	if column := q.source.Cols[q.source.Deleted]; column != nil {
+		now, err := q.compileTimeExpr(ast.NewIdent("now", 0))
+		if err != nil {
+			return "", nil, err
+		}
+		return q.compileUpdate(target, []string{column.DBName + " = " + now}, p)
+	}
+	parts, err := q.appendMutationTail(target, []string{"delete from", target + " as " + q.tableAlias()}, p)
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.Join(parts, " "), p.args, nil
+}
+
+// checkMutation returns error if update or delete has limits, does not constrain required columns
+// or has no condition (maybe after dropping of denied predicates) and bulk mutations are not allowed
+func (q *Query) checkMutation() error {
+	if q.limits != nil && (q.limits.From != nil || q.limits.Len != nil) {
+		return errors.New("limits are not allowed for update and delete")
+	}
+	cond, _, err := q.filterExpr()
+	if err != nil {
+		return err
+	}
+	if cond == nil && !q.bulk {
+		return ErrUnfiltered
+	}
+	return q.checkRequired()
+}
+
+// appendMutationTail appends where with guards, guard of version and returning clauses of update
+// or delete of target to parts
+func (q *Query) appendMutationTail(target string, parts []string, p *params, guards ...string) ([]string, error) {
+	expr, err := q.whereExpr()
+	if err != nil {
+		return nil, err
+	}
+	var where string
+	if expr != nil {
+		if where, _, err = q.compileExpr(expr); err != nil {
+			return nil, err
+		}
+	}
+	guard, err := q.compileVersionGuard(p)
+	if err != nil {
+		return nil, err
+	}
+	if guard != "" {
+		guards = append(guards, guard)
+	}
+	if len(guards) > 0 {
+		if binaryExpr, ok := expr.(*ast.BinaryExpr); ok && binaryExpr.Op == token.OR {
+			where = "(" + where + ")"
+		}
+		if where != "" {
+			where += " and "
+		}
+		where += strings.Join(guards, " and ")
+	}
+	if where != "" {
+		parts = append(parts, "where", where)
+	}
+	returning, err := q.compileReturning(target)
+	if err != nil {
+		return nil, err
+	}
+	if returning != "" {
+		parts = append(parts, "returning", returning)
+	}
+	return parts, nil
+}
+
+// compileReturning returns selected fields of insert, update or delete of target, nothing if fields are not selected
+func (q *Query) compileReturning(target string) (string, error) {
+	if q.fields == nil || len(*q.fields) == 0 {
+		return "", nil
+	}
+	returned := q
+	if q.dialect == SQLite {
+		// sqlite does not resolve alias of target in returning, so fields are qualified by target itself
+		copied := *q
+		copied.alias = target
+		returned = &copied
+	}
+	fields, joins, err := returned.compileSelect()
+	if err != nil {
+		return "", err
+	}
+	if joins != "" {
+		return "", errors.New("embedded fields and child tables can not be returned")
+	}
+	return fields, nil
+}
@@ -0,0 +1,227 @@
+package query
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+// elementAlias returns alias of elements of array of object on nesting level:
+// j for the first level, j2, j3 and so on for nested arrays
+func elementAlias(depth int) string {
+	if depth <= 1 {
+		return "j"
+	}
+	return "j" + strconv.Itoa(depth)
+}
+
+// jsonbOf returns JSON document as jsonb, because source columns may be stored as json or text
+func (q *Query) jsonbOf(base string) string {
+	if strings.HasPrefix(base, q.tableAlias()+".") {
+		return base + "::jsonb"
+	}
+	return base
+}
+
+// compileObjectFilter returns conditions of {...} on object column joined by and,
+// base is a JSON document of object and depth is a nesting level of arrays of object
+func (q *Query) compileObjectFilter(list *ast.ExprList, column *source.Col, base string, depth int) (string, error) {
+	if list == nil || len(list.Exprs) == 0 {
+		return "", errors.New("unexpected empty expression list")
+	}
+	compiled := make([]string, len(list.Exprs))
+	for i, el := range list.Exprs {
+		cond, err := q.compileObjectCondition(el, column, base, depth)
+		if err != nil {
+			return "", err
+		}
+		compiled[i] = cond
+	}
+	return strings.Join(compiled, " and "), nil
+}
+
+// compileArrayOfObjectFilter returns conditions of {...} on elements of array of object column.
+// By default all conditions must hold on the same element, with quantifier:
+// any - every condition holds on some (maybe different) element,
+// all - all conditions hold on every element,
+// none - no element satisfies all conditions
+func (q *Query) compileArrayOfObjectFilter(list *ast.ExprList, column *source.Col, array string, quantifier ast.Quantifier, depth int) (string, error) {
+	alias := elementAlias(depth + 1)
+	from := "(select jsonb_array_elements(" + array + ") item) " + alias
+	item := alias + ".item"
+
+	if quantifier == ast.QuantAny {
+		if list == nil || len(list.Exprs) == 0 {
+			return "", errors.New("unexpected empty expression list")
+		}
+		compiled := make([]string, len(list.Exprs))
+		for i, el := range list.Exprs {
+			cond, err := q.compileObjectCondition(el, column, item, depth+1)
+			if err != nil {
+				return "", err
+			}
+			compiled[i] = "exists (select 1 from " + from + " where " + cond + ")"
+		}
+		return strings.Join(compiled, " and "), nil
+	}
+
+	conds, err := q.compileObjectFilter(list, column, item, depth+1)
+	if err != nil {
+		return "", err
+	}
+	switch quantifier {
+	case "":
+		return "exists (select 1 from " + from + " where " + conds + ")", nil
+	case ast.QuantAll:
+		return "not exists (select 1 from " + from + " where (" + conds + ") is not true)", nil
+	case ast.QuantNone:
+		return "not exists (select 1 from " + from + " where " + conds + ")", nil
+	default:
+		return "", q.notDefined(string(quantifier), list.Pos())
+	}
+}
+
+// compileObjectCondition returns one condition of {...} on object column
+func (q *Query) compileObjectCondition(expr ast.Expr, column *source.Col, base string, depth int) (string, error) {
+	switch typedExpr := expr.(type) {
+	case *ast.BinaryExpr:
+		if typedExpr.Op != token.AND && typedExpr.Op != token.OR {
+			return q.compileObjectField(typedExpr, column, base, depth)
+		}
+		compiledX, err := q.compileObjectCondition(typedExpr.X, column, base, depth)
+		if err != nil {
+			return "", err
+		}
+		compiledY, err := q.compileObjectCondition(typedExpr.Y, column, base, depth)
+		if err != nil {
+			return "", err
+		}
+		op, compiledX, compiledY, err := q.compileOperator(typedExpr.Op, compiledX, compiledY, false)
+		if err != nil {
+			return "", err
+		}
+		return "(" + compiledX + " " + op + " " + compiledY + ")", nil
+	case *ast.CallExpr:
+		if typedExpr.Func.Name != "has" {
+			return "", q.notDefined(typedExpr.Func.Name, typedExpr.Func.Pos())
+		}
+		return q.compileHas(typedExpr, column, q.jsonbOf(base))
+	case *ast.UnaryExpr:
+		if typedExpr.Op != token.NOT {
+			return "", q.unexpect(typedExpr.Op, typedExpr.Pos())
+		}
+		compiled, err := q.compileObjectCondition(typedExpr.X, column, base, depth)
+		if err != nil {
+			return "", err
+		}
+		return "not " + compiled, nil
+	default:
+		return "", q.unexpect(expr.Token(), expr.Pos())
+	}
+}
+
+// compileObjectField returns condition on the field of object column,
+// base is an object itself, e.g. q.a for object or j.item for element of array of object
+func (q *Query) compileObjectField(expr *ast.BinaryExpr, column *source.Col, base string, depth int) (string, error) {
+	ident, ok := expr.X.(*ast.Ident)
+	if !ok {
+		return "", q.unexpect(expr.X.Token(), expr.X.Pos())
+	}
+	name := column.Name + "." + ident.Name
+	chain := column.Children.Path(ident.Name)
+	if chain == nil {
+		return "", q.notDefined(name, ident.Pos())
+	}
+	if err := q.checkChain(chain, name, source.Filterable, ident.Pos()); err != nil {
+		return "", err
+	}
+	for i, col := range chain[:len(chain)-1] {
+		if !col.IsArray {
+			continue
+		}
+		// c.d=4 where c is array of object is the same as c={d=4}
+		rest := make([]string, 0, len(chain)-i-1)
+		for _, c := range chain[i+1:] {
+			rest = append(rest, c.Name)
+		}
+		inner := ast.NewBinaryExpr(expr.Op, ast.NewIdent(strings.Join(rest, "."), ident.Pos()), expr.Y, expr.Pos())
+		return q.compileArrayOfObjectFilter(ast.NewExprList(expr.Pos(), inner), col, q.jsonbOf(base)+" #> '{"+keysOf(chain[:i+1])+"}'", "", depth)
+	}
+
+	child := chain[len(chain)-1]
+	path := q.jsonbOf(base) + " #> '{" + keysOf(chain) + "}'"
+	var list *ast.ExprList
+	var quantifier ast.Quantifier
+	switch y := expr.Y.(type) {
+	case *ast.ExprList:
+		list = y
+	case *ast.QuantifiedExpr:
+		list, _ = y.X.(*ast.ExprList)
+		quantifier = y.Quantifier
+	}
+	if list != nil && child.Type == source.TypeObject {
+		if expr.Op != token.EQL && expr.Op != token.NEQ {
+			return "", q.mustBe(expr.Op.String(), "= or !=", "any", expr.Pos())
+		}
+		var compiled string
+		var err error
+		if child.IsArray {
+			compiled, err = q.compileArrayOfObjectFilter(list, child, path, quantifier, depth)
+		} else if quantifier == "" {
+			compiled, err = q.compileObjectFilter(list, child, "("+path+")", depth)
+		} else {
+			err = q.mustBe(name, "array of object", "object", ident.Pos())
+		}
+		if err != nil {
+			return "", err
+		}
+		if expr.Op == token.NEQ {
+			return "not (" + compiled + ")", nil
+		}
+		return compiled, nil
+	}
+
+	if isNull(expr.Y) {
+		return q.compileJSONNull(expr.Op, chain, q.jsonbOf(base), false, ident.Pos())
+	}
+	if child.Type == source.TypeObject {
+		return "", q.mustBe(name, "boolean/numeric/text/timestamp", "any", ident.Pos())
+	}
+	typeCast := q.compileType(child.Type)
+	compiledX := "(" + base + " #>> '{" + keysOf(chain) + "}')::" + typeCast
+	if expr.Op.IsPattern() {
+		return q.compilePattern(expr.Op, child, compiledX, expr.Y)
+	}
+	var compiledY string
+	yConst, ok := expr.Y.(*ast.Const)
+	needTypeCast := ok
+	if !ok {
+		yIdent, ok := expr.Y.(*ast.Ident)
+		if !ok {
+			return "", q.unexpect(expr.Y.Token(), expr.Y.Pos())
+		}
+		if yIdent.Name != "true" && yIdent.Name != "false" {
+			return "", q.unexpect(expr.Y.Token(), expr.Y.Pos())
+		}
+		compiledY = yIdent.Name
+	} else {
+		var err error
+		compiledY, err = q.compileValue(child, yConst)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	op, compiledX, compiledY, err := q.compileOperator(expr.Op, compiledX, compiledY, false)
+	if err != nil {
+		return "", err
+	}
+	if needTypeCast {
+		compiledY += "::" + typeCast
+	}
+	return compiledX + " " + op + " " + compiledY, nil
+}
@@ -0,0 +1,409 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/x-foby/w3sql/source"
+)
+
+// operations of JSON Patch
+const (
+	patchAdd     = "add"
+	patchRemove  = "remove"
+	patchReplace = "replace"
+	patchTest    = "test"
+)
+
+// errPartialJSON is returned if partial update of JSON is compiled for not postgres dialect
+var errPartialJSON = errors.New("partial json updates are supported in postgres only")
+
+// CompileMergePatch returns update of rows of target that match condition by JSON Merge Patch (RFC 7386)
+// and its arguments. Objects of object columns are merged by jsonb_set, other values are assigned
+func (q *Query) CompileMergePatch(target string, doc interface{}) (string, []interface{}, error) {
+	if q.source == nil {
+		return "", nil, errors.New("source is not defined")
+	}
+	patch, ok := doc.(map[string]interface{})
+	if !ok {
+		return "", nil, valueMustBe("merge patch", "object", doc)
+	}
+	if len(patch) == 0 {
+		return "", nil, errors.New("nothing to update")
+	}
+	if err := q.checkMutation(); err != nil {
+		return "", nil, err
+	}
+
+	names := sortedKeys(patch)
+	p := &params{dialect: q.dialect}
+	sets := make([]string, len(names))
+	for i, name := range names {
+		column, err := q.writableColumn(q.source.Cols, name, name)
+		if err != nil {
+			return "", nil, err
+		}
+		var compiled string
+		if object, ok := patch[name].(map[string]interface{}); ok && column.Type == source.TypeObject && !column.IsArray {
+			if q.dialect != Postgres {
+				return "", nil, errPartialJSON
+			}
+			compiled, err = q.compileMergeObject(column, name, q.jsonbOf(q.compileColumn(column)), object, p)
+		} else if err = q.checkJSONValue(column, name, patch[name], false); err == nil {
+			compiled, err = q.compileParam(column, patch[name], p)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		sets[i] = column.DBName + " = " + compiled
+	}
+	return q.compileUpdate(target, sets, p)
+}
+
+// compileMergeObject returns object of column, base is its current value, merged with patch:
+// null removes key, object is merged into child object, other values replace children
+func (q *Query) compileMergeObject(column *source.Col, name, base string, patch map[string]interface{}, p *params) (string, error) {
+	compiled := "coalesce(" + base + ", '{}')"
+	for _, key := range sortedKeys(patch) {
+		child, err := q.writableColumn(column.Children, key, name+"."+key)
+		if err != nil {
+			return "", err
+		}
+		value, path := patch[key], "'{"+child.DBName+"}'"
+		object, ok := value.(map[string]interface{})
+		switch {
+		case value == nil:
+			compiled = "(" + compiled + " #- " + path + ")"
+		case ok && child.Type == source.TypeObject && !child.IsArray:
+			merged, err := q.compileMergeObject(child, name+"."+key, "("+base+" -> '"+child.DBName+"')", object, p)
+			if err != nil {
+				return "", err
+			}
+			compiled = "jsonb_set(" + compiled + ", " + path + ", " + merged + ")"
+		default:
+			if err := q.checkJSONValue(child, name+"."+key, value, false); err != nil {
+				return "", err
+			}
+			param, err := compileJSONParam(value, p)
+			if err != nil {
+				return "", err
+			}
+			compiled = "jsonb_set(" + compiled + ", " + path + ", " + param + ")"
+		}
+	}
+	return compiled, nil
+}
+
+// compileJSONParam returns placeholder of value passed as JSON text and casted to jsonb
+func compileJSONParam(value interface{}, p *params) (string, error) {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return p.add(string(buf)) + "::jsonb", nil
+}
+
+// patchedColumn contains value of column changed by operations of JSON Patch
+type patchedColumn struct {
+	col      *source.Col
+	value    string
+	nullable bool // value may be null, so it must be coalesced before partial update
+}
+
+// jsonPatch contains columns changed by operations of JSON Patch, checks of update
+// produced by test operations and paths that must exist, and arguments
+type jsonPatch struct {
+	patched map[string]*patchedColumn
+	guards  []string
+	p       *params
+}
+
+// CompileJSONPatch returns update of rows of target that match condition by JSON Patch (RFC 6902)
+// and its arguments. Operations add, remove, replace and test are supported, they are applied in order,
+// move and copy are not. Paths inside object and array columns are compiled into jsonb_set, jsonb_insert and #-,
+// elements of native arrays are changed by slices. Test operations and paths that must exist for remove
+// and replace are compiled into condition of update, so rows that do not match them are not changed
+func (q *Query) CompileJSONPatch(target string, doc interface{}) (string, []interface{}, error) {
+	if q.source == nil {
+		return "", nil, errors.New("source is not defined")
+	}
+	ops, ok := doc.([]interface{})
+	if !ok {
+		return "", nil, valueMustBe("json patch", "array", doc)
+	}
+	if len(ops) == 0 {
+		return "", nil, errors.New("nothing to update")
+	}
+	if err := q.checkMutation(); err != nil {
+		return "", nil, err
+	}
+
+	patch := &jsonPatch{patched: map[string]*patchedColumn{}, p: &params{dialect: q.dialect}}
+	for i, op := range ops {
+		if err := q.applyPatchOperation(op, patch); err != nil {
+			return "", nil, fmt.Errorf("operations[%d]: %v", i, err)
+		}
+	}
+	if len(patch.patched) == 0 {
+		return "", nil, errors.New("nothing to update")
+	}
+	names := make([]string, 0, len(patch.patched))
+	for name := range patch.patched {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sets := make([]string, len(names))
+	for i, name := range names {
+		sets[i] = patch.patched[name].col.DBName + " = " + patch.patched[name].value
+	}
+	return q.compileUpdate(target, sets, patch.p, patch.guards...)
+}
+
+// applyPatchOperation changes value of column by operation of JSON Patch
+func (q *Query) applyPatchOperation(doc interface{}, patch *jsonPatch) error {
+	op, ok := doc.(map[string]interface{})
+	if !ok {
+		return valueMustBe("operation", "object", doc)
+	}
+	name, _ := op["op"].(string)
+	switch name {
+	case patchAdd, patchRemove, patchReplace, patchTest:
+	case "move", "copy":
+		return fmt.Errorf("op %v is not supported, only add, remove, replace and test are", name)
+	default:
+		return fmt.Errorf("op must be one of add, remove, replace, test not %v", op["op"])
+	}
+	value, hasValue := op["value"]
+	if name != patchRemove && !hasValue {
+		return fmt.Errorf("value of %v is missing", name)
+	}
+	pointer, _ := op["path"].(string)
+	if !strings.HasPrefix(pointer, "/") {
+		return fmt.Errorf("path must be JSON pointer like /a/b not %q", pointer)
+	}
+	segments := strings.Split(pointer[1:], "/")
+	for i, segment := range segments {
+		segments[i] = strings.Replace(strings.Replace(segment, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	column, err := q.writableColumn(q.source.Cols, segments[0], segments[0])
+	if err != nil {
+		return err
+	}
+	if name == patchTest {
+		// test is a condition, so it must not reveal values that can not be filtered
+		if err := q.checkChain([]*source.Col{column}, column.Name, source.Filterable, 0); err != nil {
+			return err
+		}
+	}
+	current := patch.patched[column.Name]
+	if current == nil {
+		current = &patchedColumn{col: column, value: q.compileColumn(column), nullable: true}
+		if name != patchTest {
+			patch.patched[column.Name] = current
+		}
+	}
+
+	if len(segments) == 1 {
+		if name == patchRemove {
+			value = nil
+		}
+		if err := q.checkJSONValue(column, column.Name, value, false); err != nil {
+			return err
+		}
+		if name == patchTest {
+			return q.testPatchColumn(current, value, patch)
+		}
+		current.value, err = q.compilePatchValue(column, value, patch.p)
+		current.nullable = value == nil
+		return err
+	}
+	if q.dialect != Postgres {
+		return errPartialJSON
+	}
+	if isNative(column) {
+		return q.patchNativeArray(current, name, segments[1:], value, patch)
+	}
+	return q.patchJSON(current, name, segments[1:], value, patch)
+}
+
+// compilePatchValue returns value of column typed as it, so it can be changed by the next operations
+func (q *Query) compilePatchValue(column *source.Col, value interface{}, p *params) (string, error) {
+	switch {
+	case isNative(column) && value == nil:
+		return "null::" + q.compileType(column.Type) + "[]", nil
+	case isNative(column):
+		return q.compileParam(column, value, p)
+	case column.IsArray || column.Type == source.TypeObject || column.Type == source.TypeJSON:
+		if value == nil {
+			return "null::jsonb", nil
+		}
+		return compileJSONParam(value, p)
+	default:
+		return q.compileParam(column, value, p)
+	}
+}
+
+// testPatchColumn appends check that value of column is equal to value of test operation
+func (q *Query) testPatchColumn(current *patchedColumn, value interface{}, patch *jsonPatch) error {
+	column := current.col
+	if value == nil {
+		patch.guards = append(patch.guards, current.value+" is null")
+		return nil
+	}
+	compiled, param, err := current.value, "", error(nil)
+	if !isNative(column) && (column.IsArray || column.Type == source.TypeObject || column.Type == source.TypeJSON) {
+		compiled = q.jsonbOf(compiled)
+		param, err = compileJSONParam(value, patch.p)
+	} else {
+		param, err = q.compileParam(column, value, patch.p)
+	}
+	if err != nil {
+		return err
+	}
+	patch.guards = append(patch.guards, compiled+" = "+param)
+	return nil
+}
+
+// patchNativeArray changes element of native array by index, - appends element.
+// Element must exist for remove, replace and test
+func (q *Query) patchNativeArray(current *patchedColumn, op string, segments []string, value interface{}, patch *jsonPatch) error {
+	column := current.col
+	if len(segments) != 1 {
+		return fmt.Errorf("%v has no children", column.Name)
+	}
+	index, err := patchIndex(segments[0], op == patchAdd)
+	if err != nil {
+		return err
+	}
+	name := column.Name + "[" + segments[0] + "]"
+	var element string
+	if op != patchRemove {
+		if value == nil {
+			return fmt.Errorf("%v can not be null", name)
+		}
+		if err := q.checkJSONValue(column, name, value, true); err != nil {
+			return err
+		}
+		scalar := *column
+		scalar.IsArray, scalar.Storage = false, source.StorageJSON
+		if element, err = q.compileParam(&scalar, value, patch.p); err != nil {
+			return err
+		}
+		element += "::" + q.compileType(column.Type)
+	}
+	array, i := "("+current.value+")", strconv.Itoa(index)
+	switch {
+	case index < 0:
+		current.value = "array_append(" + current.value + ", " + element + ")"
+	case op == patchAdd:
+		current.value = array + "[:" + i + "] || " + element + " || " + array + "[" + strconv.Itoa(index+1) + ":]"
+	case op == patchTest:
+		patch.guards = append(patch.guards, array+"["+strconv.Itoa(index+1)+"] = "+element)
+	case op == patchReplace:
+		patch.guards = append(patch.guards, "cardinality("+current.value+") > "+i)
+		current.value = array + "[:" + i + "] || " + element + " || " + array + "[" + strconv.Itoa(index+2) + ":]"
+	default:
+		patch.guards = append(patch.guards, "cardinality("+current.value+") > "+i)
+		current.value = array + "[:" + i + "] || " + array + "[" + strconv.Itoa(index+2) + ":]"
+	}
+	return nil
+}
+
+// patchJSON changes value by path inside object or array column stored as JSON.
+// Path must exist for remove, replace and test
+func (q *Query) patchJSON(current *patchedColumn, op string, segments []string, value interface{}, patch *jsonPatch) error {
+	column, name := current.col, current.col.Name
+	keys := make([]string, len(segments))
+	isElement := false
+	for i, segment := range segments {
+		if column.IsArray && !isElement {
+			index, err := patchIndex(segment, op == patchAdd && i == len(segments)-1)
+			if err != nil {
+				return err
+			}
+			keys[i] = strconv.Itoa(index)
+			name += "[" + segment + "]"
+			isElement = true
+			continue
+		}
+		if column.Type != source.TypeObject {
+			return fmt.Errorf("%v has no children", name)
+		}
+		child, err := q.writableColumn(column.Children, segment, name+"."+segment)
+		if err != nil {
+			return err
+		}
+		if op == patchTest {
+			if err := q.checkChain([]*source.Col{child}, name+"."+segment, source.Filterable, 0); err != nil {
+				return err
+			}
+		}
+		keys[i] = child.DBName
+		column, name, isElement = child, name+"."+segment, false
+	}
+
+	base := current.value
+	if current.nullable {
+		empty := "'{}'"
+		if current.col.IsArray {
+			empty = "'[]'"
+		}
+		base = "coalesce(" + q.jsonbOf(current.value) + ", " + empty + ")"
+	}
+	path := "'{" + strings.Join(keys, ",") + "}'"
+	if op == patchTest {
+		if err := q.checkJSONValue(column, name, value, isElement); err != nil {
+			return err
+		}
+		param, err := compileJSONParam(value, patch.p)
+		if err != nil {
+			return err
+		}
+		patch.guards = append(patch.guards, "("+base+" #> "+path+") = "+param)
+		return nil
+	}
+	if op != patchAdd {
+		// missing path is SQL null, but JSON null is not
+		patch.guards = append(patch.guards, "("+base+" #> "+path+") is not null")
+	}
+	current.value, current.nullable = base, false
+	if op == patchRemove {
+		current.value = "(" + current.value + " #- " + path + ")"
+		return nil
+	}
+	if err := q.checkJSONValue(column, name, value, isElement); err != nil {
+		return err
+	}
+	param, err := compileJSONParam(value, patch.p)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !isElement && op == patchAdd:
+		current.value = "jsonb_set(" + current.value + ", " + path + ", " + param + ")"
+	case op == patchReplace:
+		current.value = "jsonb_set(" + current.value + ", " + path + ", " + param + ", false)"
+	case keys[len(keys)-1] == "-1":
+		current.value = "jsonb_insert(" + current.value + ", " + path + ", " + param + ", true)"
+	default:
+		current.value = "jsonb_insert(" + current.value + ", " + path + ", " + param + ")"
+	}
+	return nil
+}
+
+// patchIndex returns index of array element of JSON pointer, - is allowed for append and returns -1
+func patchIndex(segment string, appendable bool) (int, error) {
+	if segment == "-" && appendable {
+		return -1, nil
+	}
+	index, err := strconv.Atoi(segment)
+	if err != nil || index < 0 || strings.HasPrefix(segment, "+") || (len(segment) > 1 && segment[0] == '0') {
+		return 0, fmt.Errorf("index of array must be non-negative integer not %q", segment)
+	}
+	return index, nil
+}
@@ -2,6 +2,7 @@ package query
 
 import (
 	"strconv"
+	"time"
 
 	"github.com/x-foby/w3sql/ast"
 	"github.com/x-foby/w3sql/source"
@@ -13,11 +14,43 @@ type Query struct {
 	path      string
 	fields    *ast.IdentList
 	condition ast.Expr
+	policy    ast.Expr // mandatory condition that is not checked by capabilities of columns
 	orderBy   *ast.OrderByStmtList
 	limits    *ast.LimitsStmt
 	source    *source.Source
+	dialect   Dialect
+	clock     func() time.Time
+	alias     string // alias of source table, q by default
+	parent    *Query // query that contains this one as subquery
+	roles     []string
+	access    Access
+	bulk      bool    // allows update and delete without condition
+	upsert    *upsert // conflict keys and updated columns of insert
+	versions  []string
+	// allows $withDeleted flag
+	deletedAllowed bool
+	// policies of related sources read by subqueries
+	relatedPolicy RelatedPolicy
 }
 
+// Dialect is a SQL dialect that Query compiles to
+type Dialect int
+
+// dialects
+const (
+	Postgres Dialect = iota
+	SQLite
+)
+
+// Access defines how fields that are not allowed for roles of Query are compiled
+type Access int
+
+// access modes
+const (
+	RejectDenied Access = iota // compilation fails
+	DropDenied                 // fields are silently dropped from select list, condition and order by
+)
+
 // New returns new Query
 func New(path string, fields *ast.IdentList, expr ast.Expr, orderBy *ast.OrderByStmtList, limits *ast.LimitsStmt) *Query {
 	return &Query{path: path,
@@ -34,6 +67,75 @@ func (q *Query) WithSource(s *source.Source) *Query {
 	return q
 }
 
+// WithPolicy set mandatory condition, e.g. tenant_id=1, that is joined with condition by and.
+// Policy is not a part of Condition, so it can not be rewritten, and may refer to hidden columns
+func (q *Query) WithPolicy(policy ast.Expr) *Query {
+	q.policy = policy
+	return q
+}
+
+// Policy returns mandatory condition
+func (q *Query) Policy() ast.Expr {
+	return q.policy
+}
+
+// RelatedPolicy returns mandatory condition of related source, nil if source has no policy
+type RelatedPolicy func(s *source.Source) (ast.Expr, error)
+
+// WithRelatedPolicy set function that returns policies of related sources, they are joined by and
+// with conditions of subqueries and embedded fields that read related sources
+func (q *Query) WithRelatedPolicy(p RelatedPolicy) *Query {
+	q.relatedPolicy = p
+	return q
+}
+
+// WithRoles set roles of client that restrict columns with source.Col.Roles
+func (q *Query) WithRoles(roles ...string) *Query {
+	q.roles = roles
+	return q
+}
+
+// Roles returns roles of client
+func (q *Query) Roles() []string {
+	return q.roles
+}
+
+// WithAccess set how fields that are not allowed for roles are compiled, RejectDenied by default.
+// Conditions of relations and child tables always reject them
+func (q *Query) WithAccess(a Access) *Query {
+	q.access = a
+	return q
+}
+
+// WithDialect set SQL dialect, Postgres by default
+func (q *Query) WithDialect(d Dialect) *Query {
+	q.dialect = d
+	return q
+}
+
+// WithClock set function that returns current time for relative time expressions,
+// time.Now by default. Current time is compiled in UTC
+func (q *Query) WithClock(clock func() time.Time) *Query {
+	q.clock = clock
+	return q
+}
+
+// now returns current time using clock
+func (q *Query) now() time.Time {
+	if q.clock == nil {
+		return time.Now()
+	}
+	return q.clock()
+}
+
+// tableAlias returns alias of source table in compiled query
+func (q *Query) tableAlias() string {
+	if q.alias == "" {
+		return "q"
+	}
+	return q.alias
+}
+
 // Path returns path
 func (q *Query) Path() string {
 	return q.path
@@ -94,3 +196,16 @@ func (q *Query) WrapCondition(x ast.Expr, operator token.Token) {
 func (q *Query) OrderBy() *ast.OrderByStmtList {
 	return q.orderBy
 }
+
+// Functions describes functions and pseudo identifiers of condition by examples of them
+var Functions = map[string]string{
+	"has(a.b)":                                  "key b of JSON column a exists",
+	"length(a)>2":                               "length of array a",
+	"a>any 90, a=all{1,2}, a=none{1}":           "some, every or no element of array a matches",
+	"now-7d, startof(month)+1M":                 "current time in UTC or start of unit shifted by intervals",
+	pseudoExists + "(orders?{status=\"open\"})": "related rows matched by condition exist",
+	"id=@orders.customer_id?status=\"open\"":    "value is in field of related rows matched by condition",
+	pseudoOuter + "id":                          "column id of outer query in condition of related rows",
+	pseudoSearch + "=\"text\", a@@\"text\"":     "full-text search by search columns of source or by column a, :-" + pseudoRank + " sorts by rank",
+	pseudoWithDeleted:                           "flag that includes soft-deleted rows if it is allowed",
+}
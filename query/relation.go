@@ -0,0 +1,335 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+// pseudo function of semi-join
+const pseudoExists = "$exists"
+
+// prefix of column of outer query referred by subquery, e.g. $exists(orders?{customer_id=$outer.id})
+const pseudoOuter = "$outer."
+
+// relation returns relation of source by name
+func (q *Query) relation(name *ast.Ident) (*source.Relation, error) {
+	if col := q.source.Cols[name.Name]; col != nil && col.Storage == source.StorageTable {
+		return col.Relation(), nil
+	}
+	rel, ok := q.source.Relations[name.Name]
+	if !ok || rel.Source == nil {
+		return nil, q.notDefined(name.Name, name.Pos())
+	}
+	return rel, nil
+}
+
+// subquery returns query over related source, that can refer to columns of q
+func (q *Query) subquery(rel *source.Relation, cond ast.Expr) *Query {
+	depth := 1
+	for parent := q.parent; parent != nil; parent = parent.parent {
+		depth++
+	}
+	alias := "r"
+	if depth > 1 {
+		alias += strconv.Itoa(depth)
+	}
+	return &Query{
+		condition: cond,
+		source:    rel.Source,
+		dialect:   q.dialect,
+		clock:     q.clock,
+		alias:     alias,
+		parent:    q,
+		roles:     q.roles,
+
+		relatedPolicy: q.relatedPolicy,
+	}
+}
+
+// compileSubqueryCondition returns condition of subquery, list is compiled as conditions joined by and
+func (q *Query) compileSubqueryCondition() (string, error) {
+	list, ok := q.condition.(*ast.ExprList)
+	if !ok {
+		return q.compileWhere()
+	}
+	if err := q.checkFilterable(list); err != nil {
+		return "", err
+	}
+	compiled := ""
+	for _, el := range list.Exprs {
+		if !isCondition(el) {
+			return "", q.unexpect(el.Token(), el.Pos())
+		}
+		cond, _, err := q.compileExpr(el)
+		if err != nil {
+			return "", err
+		}
+		if x, ok := el.(*ast.BinaryExpr); ok && x.Op == token.OR {
+			cond = "(" + cond + ")"
+		}
+		if compiled != "" {
+			compiled += " and "
+		}
+		compiled += cond
+	}
+	return compiled, nil
+}
+
+// relatedField returns relation and name of field of related source for dotted name like customer.name
+func (q *Query) relatedField(name string) (*source.Relation, string) {
+	i := strings.Index(name, ".")
+	if i <= 0 {
+		return nil, ""
+	}
+	if col := q.source.Cols.ByName(name[:i]); col != nil {
+		// fields of object stored in child table are fields of related source
+		if rel := col.Relation(); rel != nil {
+			return rel, name[i+1:]
+		}
+		return nil, ""
+	}
+	rel, ok := q.source.Relations[name[:i]]
+	if !ok || rel.Source == nil {
+		return nil, ""
+	}
+	return rel, name[i+1:]
+}
+
+// compileRelated returns from and where clauses of subquery sub over rows related by relation keys,
+// soft-deleted rows are excluded and policy of related source is applied
+func (q *Query) compileRelated(rel *source.Relation, sub *Query, pos token.Pos) (string, string, error) {
+	from, where, err := q.compileRelatedJoin(rel, sub, pos)
+	if err != nil {
+		return "", "", err
+	}
+	policy, err := sub.compileRelatedPolicy()
+	if err != nil {
+		return "", "", err
+	}
+	if policy != "" {
+		if where != "" {
+			where += " and "
+		}
+		where += policy
+	}
+	if deleted := notDeleted(rel.Source); deleted != nil {
+		compiled, _, err := sub.compileExpr(deleted)
+		if err != nil {
+			return "", "", err
+		}
+		if where != "" {
+			where += " and "
+		}
+		where += compiled
+	}
+	return from, where, nil
+}
+
+// compileRelatedPolicy returns policy of source of subquery q, nothing if source has no policy
+func (q *Query) compileRelatedPolicy() (string, error) {
+	if q.relatedPolicy == nil {
+		return "", nil
+	}
+	policy, err := q.relatedPolicy(q.source)
+	if err != nil || policy == nil {
+		return "", err
+	}
+	q.policy = policy
+	compiled, _, err := q.compileExpr(policy)
+	if err != nil {
+		return "", err
+	}
+	if x, ok := policy.(*ast.BinaryExpr); ok && x.Op == token.OR {
+		compiled = "(" + compiled + ")"
+	}
+	return compiled, nil
+}
+
+// restricted returns true if q or any query that contains it has policy
+func (q *Query) restricted() bool {
+	for query := q; query != nil; query = query.parent {
+		if query.policy != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// compileRelatedJoin returns from and where clauses of subquery that join related source with source.
+// Relation without keys is not joined, so it is rejected under policy
+func (q *Query) compileRelatedJoin(rel *source.Relation, sub *Query, pos token.Pos) (string, string, error) {
+	from := rel.Table + " " + sub.tableAlias()
+	if rel.Key == "" || rel.ForeignKey == "" {
+		if q.restricted() {
+			return "", "", q.mustBe(rel.Name, "relation with keys", "relation without keys under policy", pos)
+		}
+		return from, "", nil
+	}
+	key := q.source.Cols.ByName(rel.Key)
+	if key == nil {
+		return "", "", q.notDefined(rel.Key, pos)
+	}
+	foreignKey := rel.Source.Cols.ByName(rel.ForeignKey)
+	if foreignKey == nil {
+		return "", "", q.notDefined(rel.Name+"."+rel.ForeignKey, pos)
+	}
+	if rel.Kind != source.ManyToMany || rel.Link == nil {
+		return from, sub.compileColumn(foreignKey) + " = " + q.compileColumn(key), nil
+	}
+	link := "l" + strings.TrimPrefix(sub.tableAlias(), "r")
+	from += " join " + rel.Link.Table + " " + link + " on " + link + "." + rel.Link.ForeignKey + " = " + sub.compileColumn(foreignKey)
+	return from, link + "." + rel.Link.Key + " = " + q.compileColumn(key), nil
+}
+
+// compileExists returns exists subquery over related source, e.g. $exists(orders?{status="open"})
+func (q *Query) compileExists(expr *ast.CallExpr) (string, error) {
+	if len(expr.Args) != 1 {
+		return "", q.mustBe(expr.Func.Name, "called with 1 argument", strconv.Itoa(len(expr.Args)), expr.Pos())
+	}
+	switch arg := expr.Args[0].(type) {
+	case *ast.Ident:
+		return q.compileExistsRelated(arg, nil)
+	case *ast.SubqueryExpr:
+		if arg.Field != nil {
+			return "", q.unexpect(arg.Token(), arg.Pos())
+		}
+		return q.compileExistsRelated(arg.Relation, arg.Cond)
+	default:
+		return "", q.unexpect(arg.Token(), arg.Pos())
+	}
+}
+
+// compileExistsRelated returns check that source has related rows matched by condition
+func (q *Query) compileExistsRelated(name *ast.Ident, cond ast.Expr) (string, error) {
+	rel, err := q.relation(name)
+	if err != nil {
+		return "", err
+	}
+	sub := q.subquery(rel, cond)
+	from, where, err := q.compileRelated(rel, sub, name.Pos())
+	if err != nil {
+		return "", err
+	}
+	if cond != nil {
+		compiledCond, err := sub.compileSubqueryCondition()
+		if err != nil {
+			return "", err
+		}
+		if x, ok := cond.(*ast.BinaryExpr); ok && x.Op == token.OR && where != "" {
+			compiledCond = "(" + compiledCond + ")"
+		}
+		if where != "" {
+			where += " and "
+		}
+		where += compiledCond
+	}
+	compiled := "exists (select 1 from " + from
+	if where != "" {
+		compiled += " where " + where
+	}
+	return compiled + ")", nil
+}
+
+// compileRelatedValue returns value of field of one-to-one related source, e.g. for sorting by customer.name
+func (q *Query) compileRelatedValue(rel *source.Relation, field *ast.Ident) (string, error) {
+	if rel.Kind != source.OneToOne {
+		return "", q.mustBe(rel.Name+"."+field.Name, "field of one-to-one relation", "field of to-many relation", field.Pos())
+	}
+	if rel.Source.Cols.Path(field.Name) == nil {
+		return "", q.notDefined(rel.Name+"."+field.Name, field.Pos())
+	}
+	sub := q.subquery(rel, nil)
+	compiled, err := sub.compileColumnPath(field.Name, field.Pos())
+	if err != nil {
+		return "", err
+	}
+	from, where, err := q.compileRelated(rel, sub, field.Pos())
+	if err != nil {
+		return "", err
+	}
+	compiled = "select " + compiled + " from " + from
+	if where != "" {
+		compiled += " where " + where
+	}
+	return "(" + compiled + " limit 1)", nil
+}
+
+// compileIn returns check that column is (or is not) in the values of field of related source,
+// e.g. id=@orders.customer_id?status="open"
+func (q *Query) compileIn(expr *ast.BinaryExpr, y *ast.SubqueryExpr) (string, error) {
+	x, ok := expr.X.(*ast.Ident)
+	if !ok {
+		return "", q.unexpect(expr.X.Token(), expr.X.Pos())
+	}
+	if y.Field == nil {
+		return "", q.mustBe(y.Relation.Name, "field of related source", "source", y.Pos())
+	}
+	column := q.source.Cols.ByName(x.Name)
+	if column == nil {
+		return "", q.notDefined(x.Name, x.Pos())
+	}
+	rel, err := q.relation(y.Relation)
+	if err != nil {
+		return "", err
+	}
+	field := rel.Source.Cols.ByName(y.Field.Name)
+	if field == nil {
+		return "", q.notDefined(y.Relation.Name+"."+y.Field.Name, y.Field.Pos())
+	}
+	if column.Type == source.TypeObject || column.IsArray || field.Type == source.TypeObject || field.IsArray {
+		return "", q.mustBe(x.Name, "compared with boolean/numeric/text/timestamp", "object or array", x.Pos())
+	}
+	if column.Type != field.Type {
+		return "", q.mustBe(y.Relation.Name+"."+y.Field.Name, q.compileType(column.Type), q.compileType(field.Type), y.Field.Pos())
+	}
+	compiledX, err := q.compileIdent(x)
+	if err != nil {
+		return "", err
+	}
+	sub := q.subquery(rel, y.Cond)
+	if err := sub.checkAllowed(rel.Source.Cols, y.Field.Name, source.Filterable, y.Field.Pos()); err != nil {
+		return "", err
+	}
+	compiledField, err := sub.compileIdent(y.Field)
+	if err != nil {
+		return "", err
+	}
+	compiled := "select " + compiledField + " from " + rel.Table + " " + sub.tableAlias()
+	var conds []string
+	if y.Cond != nil {
+		where, err := sub.compileSubqueryCondition()
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, where)
+	}
+	if deleted := notDeleted(rel.Source); deleted != nil {
+		where, _, err := sub.compileExpr(deleted)
+		if err != nil {
+			return "", err
+		}
+		if x, ok := y.Cond.(*ast.BinaryExpr); ok && x.Op == token.OR {
+			conds[0] = "(" + conds[0] + ")"
+		}
+		conds = append(conds, where)
+	}
+	policy, err := sub.compileRelatedPolicy()
+	if err != nil {
+		return "", err
+	}
+	if policy != "" {
+		conds = append(conds, policy)
+	}
+	if len(conds) > 0 {
+		compiled += " where " + strings.Join(conds, " and ")
+	}
+	op := " in "
+	if expr.Op == token.NEQ {
+		op = " not in "
+	}
+	return compiledX + op + "(" + compiled + ")", nil
+}
@@ -0,0 +1,70 @@
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/token"
+)
+
+// MissingRequiredError is returned if condition does not constrain required columns
+type MissingRequiredError struct {
+	Cols []string // names of required columns sorted by name
+}
+
+// Error implements error
+func (e *MissingRequiredError) Error() string {
+	return "condition must constrain required columns: " + strings.Join(e.Cols, ", ")
+}
+
+// checkRequired returns MissingRequiredError if top-level and-chains of condition and policy
+// have no usable predicate on any of required columns. Predicates dropped for roles of query do not count
+func (q *Query) checkRequired() error {
+	cond, _, err := q.filterExpr()
+	if err != nil {
+		return err
+	}
+	constrained := map[string]bool{}
+	q.collectConstrained(cond, constrained)
+	q.collectConstrained(q.policy, constrained)
+	var missing []string
+	for name, col := range q.source.Cols {
+		if col.Required && !constrained[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return &MissingRequiredError{Cols: missing}
+}
+
+// collectConstrained marks columns that are compared with values by =, <, <=, >, >= or in list
+// in top-level and-chain of expr
+func (q *Query) collectConstrained(expr ast.Expr, constrained map[string]bool) {
+	binaryExpr, ok := expr.(*ast.BinaryExpr)
+	if !ok {
+		return
+	}
+	switch binaryExpr.Op {
+	case token.AND:
+		q.collectConstrained(binaryExpr.X, constrained)
+		q.collectConstrained(binaryExpr.Y, constrained)
+	case token.EQL, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		x, ok := binaryExpr.X.(*ast.Ident)
+		if !ok || q.source.Cols[x.Name] == nil {
+			return
+		}
+		switch y := binaryExpr.Y.(type) {
+		case *ast.Ident:
+			if y.Name == "null" || q.source.Cols.ByName(y.Name) != nil {
+				return
+			}
+		case *ast.QuantifiedExpr:
+			return
+		}
+		constrained[x.Name] = true
+	}
+}
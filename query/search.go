@@ -0,0 +1,151 @@
+package query
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+// pseudo fields of full-text search
+const (
+	pseudoSearch = "$search"
+	pseudoRank   = "$rank"
+)
+
+// isSearch returns true if expression is a full-text search condition:
+// col@@"text", $search@@"text" or $search="text"
+func isSearch(expr ast.Expr) bool {
+	binaryExpr, ok := expr.(*ast.BinaryExpr)
+	if !ok {
+		return false
+	}
+	if binaryExpr.Op == token.MATCH {
+		return true
+	}
+	x, ok := binaryExpr.X.(*ast.Ident)
+	return ok && binaryExpr.Op == token.EQL && x.Name == pseudoSearch
+}
+
+// findSearch returns first full-text search condition
+func findSearch(expr ast.Expr) *ast.BinaryExpr {
+	switch typedExpr := expr.(type) {
+	case *ast.BinaryExpr:
+		if isSearch(typedExpr) {
+			return typedExpr
+		}
+		if typedExpr.Op != token.AND && typedExpr.Op != token.OR {
+			return nil
+		}
+		if found := findSearch(typedExpr.X); found != nil {
+			return found
+		}
+		return findSearch(typedExpr.Y)
+	case *ast.UnaryExpr:
+		return findSearch(typedExpr.X)
+	default:
+		return nil
+	}
+}
+
+// searchConfig returns text search configuration of source
+func (q *Query) searchConfig() string {
+	if q.source.Search == nil || q.source.Search.Config == "" {
+		return "'simple'"
+	}
+	return "'" + q.source.Search.Config + "'"
+}
+
+// compileSearchVector returns tsvector for column or for search declared on source if x is $search
+func (q *Query) compileSearchVector(x *ast.Ident) (string, error) {
+	if x.Name != pseudoSearch {
+		column := q.source.Cols.ByName(x.Name)
+		if column == nil {
+			return "", q.notDefined(x.Name, x.Pos())
+		}
+		if column.Type != source.TypeString || column.IsArray {
+			return "", q.mustBe(x.Name, "string", "any", x.Pos())
+		}
+		compiledX, err := q.compileIdent(x)
+		if err != nil {
+			return "", err
+		}
+		return "to_tsvector(" + q.searchConfig() + ", " + compiledX + ")", nil
+	}
+
+	search := q.source.Search
+	if search == nil || (search.Vector == "" && len(search.Cols) == 0) {
+		return "", q.notDefined(x.Name, x.Pos())
+	}
+	if search.Vector != "" {
+		return q.tableAlias() + "." + search.Vector, nil
+	}
+	cols := make([]string, len(search.Cols))
+	for i, name := range search.Cols {
+		column := q.source.Cols.ByName(name)
+		if column == nil {
+			return "", q.notDefined(name, x.Pos())
+		}
+		if column.Type != source.TypeString || column.IsArray {
+			return "", q.mustBe(name, "string", "any", x.Pos())
+		}
+		cols[i] = "coalesce(" + q.compileColumn(column) + ", '')"
+	}
+	return "to_tsvector(" + q.searchConfig() + ", " + strings.Join(cols, " || ' ' || ") + ")", nil
+}
+
+// compileSearchQuery returns tsquery for text constant
+func (q *Query) compileSearchQuery(y ast.Expr) (string, error) {
+	yConst, ok := y.(*ast.Const)
+	if !ok || yConst.Token() != token.STRING {
+		return "", q.mustBe("search text", "string", y.Token().String(), y.Pos())
+	}
+	compiledY, err := q.compileConst(yConst)
+	if err != nil {
+		return "", err
+	}
+	return "websearch_to_tsquery(" + q.searchConfig() + ", " + compiledY + ")", nil
+}
+
+// compileSearch returns full-text search condition
+func (q *Query) compileSearch(expr *ast.BinaryExpr) (string, error) {
+	if q.dialect != Postgres {
+		return "", errors.New("full-text search is supported in postgres only")
+	}
+	x, ok := expr.X.(*ast.Ident)
+	if !ok {
+		return "", q.unexpect(expr.X.Token(), expr.X.Pos())
+	}
+	vector, err := q.compileSearchVector(x)
+	if err != nil {
+		return "", err
+	}
+	query, err := q.compileSearchQuery(expr.Y)
+	if err != nil {
+		return "", err
+	}
+	return vector + " @@ " + query, nil
+}
+
+// compileRank returns rank of full-text search found in condition
+func (q *Query) compileRank(field *ast.Ident) (string, error) {
+	search := findSearch(q.Condition())
+	if search == nil {
+		return "", q.mustBe(field.Name, "used with search condition", "without", field.Pos())
+	}
+	x, ok := search.X.(*ast.Ident)
+	if !ok {
+		return "", q.unexpect(search.X.Token(), search.X.Pos())
+	}
+	vector, err := q.compileSearchVector(x)
+	if err != nil {
+		return "", err
+	}
+	query, err := q.compileSearchQuery(search.Y)
+	if err != nil {
+		return "", err
+	}
+	return "ts_rank(" + vector + ", " + query + ")", nil
+}
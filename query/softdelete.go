@@ -0,0 +1,69 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+// pseudo flag of condition that includes soft-deleted rows, e.g. $withDeleted&status="new"
+const pseudoWithDeleted = "$withDeleted"
+
+// WithDeletedAllowed allows $withDeleted flag that includes soft-deleted rows of source
+func (q *Query) WithDeletedAllowed(allowed bool) *Query {
+	q.deletedAllowed = allowed
+	return q
+}
+
+// withoutDeletedFlag returns condition without $withDeleted or $withDeleted=true of top-level and-chain
+// and true if flag is found
+func withoutDeletedFlag(expr ast.Expr) (ast.Expr, bool) {
+	switch typedExpr := expr.(type) {
+	case *ast.Ident:
+		if typedExpr.Name == pseudoWithDeleted {
+			return nil, true
+		}
+	case *ast.BinaryExpr:
+		switch typedExpr.Op {
+		case token.AND:
+			x, foundX := withoutDeletedFlag(typedExpr.X)
+			y, foundY := withoutDeletedFlag(typedExpr.Y)
+			switch {
+			case !foundX && !foundY:
+				return expr, false
+			case x == nil:
+				return y, true
+			case y == nil:
+				return x, true
+			}
+			return ast.NewBinaryExpr(token.AND, x, y, typedExpr.Pos()), true
+		case token.EQL:
+			x, okX := typedExpr.X.(*ast.Ident)
+			y, okY := typedExpr.Y.(*ast.Ident)
+			if okX && okY && x.Name == pseudoWithDeleted && y.Name == "true" {
+				return nil, true
+			}
+		}
+	}
+	return expr, false
+}
+
+// conditionWithDeleted returns condition without $withDeleted flag and true if soft-deleted rows are included.
+// Returns error if flag is not allowed
+func (q *Query) conditionWithDeleted() (ast.Expr, bool, error) {
+	expr, found := withoutDeletedFlag(q.condition)
+	if found && !q.deletedAllowed {
+		return nil, false, fmt.Errorf("%v is not allowed", pseudoWithDeleted)
+	}
+	return expr, found, nil
+}
+
+// notDeleted returns condition that excludes soft-deleted rows of source, nil if source has no soft delete
+func notDeleted(s *source.Source) ast.Expr {
+	if s.Deleted == "" || s.Cols[s.Deleted] == nil {
+		return nil
+	}
+	return ast.NewBinaryExpr(token.EQL, ast.NewIdent(s.Deleted, 0), ast.NewIdent("null", 0), 0)
+}
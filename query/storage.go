@@ -0,0 +1,119 @@
+package query
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+// isNative returns true if column is a native SQL array
+func isNative(column *source.Col) bool {
+	return column.IsArray && column.Storage == source.StorageArray
+}
+
+// checkNative returns error if native array column is used with not supported dialect or type
+func (q *Query) checkNative(column *source.Col, pos token.Pos) error {
+	if q.dialect != Postgres {
+		return errors.New("native arrays are supported in postgres only")
+	}
+	if column.Type == source.TypeObject {
+		return q.mustBe(column.Name, "native array of scalars", "array of object", pos)
+	}
+	return nil
+}
+
+// compileNativeArray returns array literal of compiled values typed as column, e.g. array['a', 'b']::text[]
+func (q *Query) compileNativeArray(column *source.Col, values []string) string {
+	return "array[" + strings.Join(values, ", ") + "]::" + q.compileType(column.Type) + "[]"
+}
+
+// compileContains returns check that native array column contains (or does not contain) compiled value
+func (q *Query) compileContains(op token.Token, column *source.Col, compiledX, compiledY string, pos token.Pos) (string, error) {
+	if err := q.checkNative(column, pos); err != nil {
+		return "", err
+	}
+	if op == token.NEQ {
+		return compiledY + " != all(" + compiledX + ")", nil
+	}
+	return compiledY + " = any(" + compiledX + ")", nil
+}
+
+// childFields returns embedded field with all selectable children of column stored in child table
+func (q *Query) childFields(field *ast.Ident, column *source.Col) *ast.Ident {
+	names := make([]string, 0, len(column.Children))
+	for name, child := range column.Children {
+		if child.Allows(source.Selectable) && child.AllowsRoles(q.roles, source.Selectable) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	fields := ast.NewIdentList()
+	for _, name := range names {
+		fields.Append(ast.NewIdent(name, field.Pos()))
+	}
+	return ast.NewIdent(field.Name, field.Pos()).WithFields(fields)
+}
+
+// compileChildFilter returns conditions of {...} on rows of child table of column.
+// By default all conditions must hold on the same row, quantifiers are the same as for array of object
+func (q *Query) compileChildFilter(list *ast.ExprList, column *source.Col, quantifier ast.Quantifier, pos token.Pos) (string, error) {
+	if list == nil || len(list.Exprs) == 0 {
+		return "", errors.New("unexpected empty expression list")
+	}
+	name := ast.NewIdent(column.Name, pos)
+	switch quantifier {
+	case "":
+		return q.compileExistsRelated(name, list)
+	case ast.QuantAny:
+		compiled := make([]string, len(list.Exprs))
+		for i, el := range list.Exprs {
+			cond, err := q.compileExistsRelated(name, ast.NewExprList(el.Pos(), el))
+			if err != nil {
+				return "", err
+			}
+			compiled[i] = cond
+		}
+		return strings.Join(compiled, " and "), nil
+	case ast.QuantNone:
+		compiled, err := q.compileExistsRelated(name, list)
+		if err != nil {
+			return "", err
+		}
+		return "not " + compiled, nil
+	case ast.QuantAll:
+		rel := column.Relation()
+		sub := q.subquery(rel, list)
+		from, where, err := q.compileRelated(rel, sub, pos)
+		if err != nil {
+			return "", err
+		}
+		conds, err := sub.compileSubqueryCondition()
+		if err != nil {
+			return "", err
+		}
+		if where != "" {
+			where += " and "
+		}
+		return "not exists (select 1 from " + from + " where " + where + "(" + conds + ") is not true)", nil
+	default:
+		return "", q.notDefined(string(quantifier), list.Pos())
+	}
+}
+
+// compileChildCount returns number of rows of child table of column
+func (q *Query) compileChildCount(column *source.Col, pos token.Pos) (string, error) {
+	rel := column.Relation()
+	sub := q.subquery(rel, nil)
+	from, where, err := q.compileRelated(rel, sub, pos)
+	if err != nil {
+		return "", err
+	}
+	if where != "" {
+		where = " where " + where
+	}
+	return "(select count(*) from " + from + where + ")", nil
+}
@@ -0,0 +1,161 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+// units of intervals like 7d
+var intervalUnits = map[byte]string{
+	's': "seconds",
+	'm': "minutes",
+	'h': "hours",
+	'd': "days",
+	'w': "weeks",
+	'M': "months",
+	'y': "years",
+}
+
+// units allowed in startof(...)
+var truncUnits = map[string]bool{
+	"minute":  true,
+	"hour":    true,
+	"day":     true,
+	"week":    true,
+	"month":   true,
+	"quarter": true,
+	"year":    true,
+}
+
+// isTimeExpr returns true if expression is a relative time expression:
+// now, startof(unit) or them plus/minus some intervals
+func isTimeExpr(expr ast.Expr) bool {
+	switch typedExpr := expr.(type) {
+	case *ast.Ident:
+		return typedExpr.Name == "now"
+	case *ast.CallExpr:
+		return typedExpr.Func.Name == "startof"
+	case *ast.BinaryExpr:
+		return (typedExpr.Op == token.PLUS || typedExpr.Op == token.MINUS) && isTimeExpr(typedExpr.X)
+	default:
+		return false
+	}
+}
+
+// compileTimeComparison returns comparison of time column with relative time expression
+func (q *Query) compileTimeComparison(expr *ast.BinaryExpr, x *ast.Ident) (string, error) {
+	colType := q.source.Cols.Type(x.Name)
+	if colType == nil {
+		return "", q.notDefined(x.Name, x.Pos())
+	}
+	if *colType != source.TypeTime && *colType != source.TypeDate {
+		return "", q.mustBe(x.Name, "time", "any", x.Pos())
+	}
+	compiledX, err := q.compileIdent(x)
+	if err != nil {
+		return "", err
+	}
+	compiledY, err := q.compileTimeExpr(expr.Y)
+	if err != nil {
+		return "", err
+	}
+	if *colType == source.TypeDate {
+		compiledY = q.compileUTCDate(compiledY)
+	}
+	op, compiledX, compiledY, err := q.compileOperator(expr.Op, compiledX, compiledY, false)
+	if err != nil {
+		return "", err
+	}
+	return compiledX + " " + op + " " + compiledY, nil
+}
+
+// compileUTCDate returns date of time expression in UTC
+func (q *Query) compileUTCDate(compiled string) string {
+	if q.dialect == SQLite {
+		return "date(" + compiled + ")"
+	}
+	return "((" + compiled + ") at time zone 'UTC')::date"
+}
+
+// compileTimeExpr returns relative time expression as dialect-specific sql.
+// In postgres current time is timestamptz, so it does not depend on time zone of session
+func (q *Query) compileTimeExpr(expr ast.Expr) (string, error) {
+	switch typedExpr := expr.(type) {
+	case *ast.Ident:
+		if typedExpr.Name != "now" {
+			return "", q.unexpect(typedExpr.Token(), typedExpr.Pos())
+		}
+		now := q.now().UTC().Format("2006-01-02 15:04:05")
+		if q.dialect == SQLite {
+			return "datetime('" + now + "')", nil
+		}
+		return "'" + now + "Z'::timestamptz", nil
+	case *ast.CallExpr:
+		return q.compileStartOf(typedExpr)
+	case *ast.BinaryExpr:
+		if typedExpr.Op != token.PLUS && typedExpr.Op != token.MINUS {
+			return "", q.unexpect(typedExpr.Op, typedExpr.Pos())
+		}
+		y, ok := typedExpr.Y.(*ast.Const)
+		if !ok || y.Token() != token.INTERVAL {
+			return "", q.mustBe(typedExpr.Op.String(), "followed by interval", typedExpr.Y.Token().String(), typedExpr.Y.Pos())
+		}
+		compiledX, err := q.compileTimeExpr(typedExpr.X)
+		if err != nil {
+			return "", err
+		}
+		n, unit := y.Value[:len(y.Value)-1], intervalUnits[y.Value[len(y.Value)-1]]
+		if unit == "" {
+			return "", q.unexpect(y.Token(), y.Pos())
+		}
+		if q.dialect == SQLite {
+			if unit == "weeks" {
+				// sqlite has no week modifier
+				weeks, err := strconv.Atoi(n)
+				if err != nil {
+					return "", err
+				}
+				n, unit = strconv.Itoa(weeks*7), "days"
+			}
+			return "datetime(" + compiledX + ", '" + typedExpr.Op.String() + n + " " + unit + "')", nil
+		}
+		return compiledX + " " + typedExpr.Op.String() + " interval '" + n + " " + unit + "'", nil
+	default:
+		return "", q.unexpect(expr.Token(), expr.Pos())
+	}
+}
+
+// compileStartOf returns start of unit of current time, e.g. startof(month)
+func (q *Query) compileStartOf(expr *ast.CallExpr) (string, error) {
+	if expr.Func.Name != "startof" {
+		return "", q.notDefined(expr.Func.Name, expr.Func.Pos())
+	}
+	if len(expr.Args) != 1 {
+		return "", q.mustBe(expr.Func.Name, "called with 1 argument", fmt.Sprint(len(expr.Args)), expr.Pos())
+	}
+	arg, ok := expr.Args[0].(*ast.Ident)
+	if !ok || !truncUnits[arg.Name] {
+		return "", q.mustBe("argument of "+expr.Func.Name, "minute, hour, day, week, month, quarter or year", "any", expr.Args[0].Pos())
+	}
+	now, err := q.compileTimeExpr(ast.NewIdent("now", expr.Pos()))
+	if err != nil {
+		return "", err
+	}
+	if q.dialect != SQLite {
+		return "date_trunc('" + arg.Name + "', " + now + ", 'UTC')", nil
+	}
+	switch arg.Name {
+	case "day", "month", "year":
+		return "datetime(" + now + ", 'start of " + arg.Name + "')", nil
+	case "hour":
+		return "strftime('%Y-%m-%d %H:00:00', " + now + ")", nil
+	case "minute":
+		return "strftime('%Y-%m-%d %H:%M:00', " + now + ")", nil
+	default:
+		return "", q.mustBe(expr.Func.Name+"("+arg.Name+")", "day, month, year, hour or minute", arg.Name+" in sqlite", arg.Pos())
+	}
+}
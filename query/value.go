@@ -0,0 +1,225 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/x-foby/w3sql/source"
+)
+
+// params contains arguments of parameterized statement
+type params struct {
+	dialect Dialect
+	args    []interface{}
+}
+
+// add appends argument and returns its placeholder: $1, $2 and so on, ? for sqlite
+func (p *params) add(arg interface{}) string {
+	p.args = append(p.args, arg)
+	if p.dialect == SQLite {
+		return "?"
+	}
+	return "$" + strconv.Itoa(len(p.args))
+}
+
+// jsonKind returns name of kind of decoded JSON value
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// sortedKeys returns keys of decoded JSON object sorted by name
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// valueMustBe returns error "... must be ... not ..." for decoded JSON value
+func valueMustBe(name, expected string, value interface{}) error {
+	return fmt.Errorf("%v must be %v not %v", name, expected, jsonKind(value))
+}
+
+// writableColumn returns column of cols by key, name is a full name of column like a.b.
+// Returns error if column is hidden, computed, stored in child table or is not writable for roles of query
+func (q *Query) writableColumn(cols source.Cols, key, name string) (*source.Col, error) {
+	column := cols[key]
+	if column == nil || column.Hidden {
+		return nil, fmt.Errorf("%v is not defined", name)
+	}
+	if q.source != nil && q.source.Version != "" && column == q.source.Cols[q.source.Version] {
+		return nil, fmt.Errorf("%v is changed automatically", name)
+	}
+	if column.Expr != "" || column.Storage == source.StorageTable ||
+		!column.Allows(source.Writable) || !column.AllowsRoles(q.roles, source.Writable) {
+		return nil, fmt.Errorf("%v is not writable", name)
+	}
+	return column, nil
+}
+
+// checkJSONValue returns error if decoded JSON value does not match column including children
+// of objects and elements of arrays, name is a full name of value like a.b[0]
+func (q *Query) checkJSONValue(column *source.Col, name string, value interface{}, isElement bool) error {
+	if value == nil {
+		return nil
+	}
+	if column.IsArray && !isElement {
+		elements, ok := value.([]interface{})
+		if !ok {
+			return valueMustBe(name, "array", value)
+		}
+		for i, el := range elements {
+			if err := q.checkJSONValue(column, name+"["+strconv.Itoa(i)+"]", el, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	switch column.Type {
+	case source.TypeNumber, source.TypeInteger, source.TypeDecimal:
+		return checkJSONNumber(column, name, value)
+	case source.TypeBool:
+		if _, ok := value.(bool); !ok {
+			return valueMustBe(name, "boolean", value)
+		}
+	case source.TypeJSON:
+	case source.TypeObject:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return valueMustBe(name, "object", value)
+		}
+		for _, key := range sortedKeys(object) {
+			child, err := q.writableColumn(column.Children, key, name+"."+key)
+			if err != nil {
+				return err
+			}
+			if err := q.checkJSONValue(child, name+"."+key, object[key], false); err != nil {
+				return err
+			}
+		}
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return valueMustBe(name, column.Type.String(), value)
+		}
+		return checkJSONString(column, name, s)
+	}
+	return nil
+}
+
+// checkJSONNumber returns error if value is not a number, not an integer for integer column
+// or has more digits after decimal point than scale of decimal column
+func checkJSONNumber(column *source.Col, name string, value interface{}) error {
+	var s string
+	switch n := value.(type) {
+	case float64:
+		s = strconv.FormatFloat(n, 'f', -1, 64)
+	case json.Number:
+		if _, err := n.Float64(); err != nil {
+			return valueMustBe(name, "number", value)
+		}
+		s = n.String()
+	default:
+		return valueMustBe(name, "number", value)
+	}
+	switch column.Type {
+	case source.TypeInteger:
+		if strings.ContainsAny(s, ".eE") {
+			if f, err := strconv.ParseFloat(s, 64); err != nil || f != math.Trunc(f) {
+				return fmt.Errorf("%v must be integer not %v", name, s)
+			}
+		}
+	case source.TypeDecimal:
+		if i := strings.IndexByte(s, '.'); column.Scale > 0 && i >= 0 && len(s)-i-1 > column.Scale {
+			return fmt.Errorf("%v must be decimal with scale %v not %v", name, column.Scale, s)
+		}
+	}
+	return nil
+}
+
+// checkJSONString returns error if string is not a valid value of time, date, uuid or enum column
+func checkJSONString(column *source.Col, name, s string) error {
+	var ok bool
+	switch column.Type {
+	case source.TypeTime:
+		_, err := time.Parse(time.RFC3339, s)
+		ok = err == nil
+	case source.TypeDate:
+		_, err := time.Parse("2006-01-02", s)
+		ok = err == nil
+	case source.TypeUUID:
+		ok = isUUID(s)
+	case source.TypeEnum:
+		if !hasValue(column.Values, s) {
+			return fmt.Errorf("%v must be one of %v not %q", name, strings.Join(column.Values, ", "), s)
+		}
+		ok = true
+	case source.TypeInterval:
+		ok = s != ""
+	default:
+		ok = true
+	}
+	if !ok {
+		return fmt.Errorf("%v must be %v not %q", name, column.Type, s)
+	}
+	return nil
+}
+
+// compileParam returns placeholder of checked JSON value of column. Objects, arrays and json
+// are passed as JSON text, native arrays are converted from it, integers are passed as int64
+func (q *Query) compileParam(column *source.Col, value interface{}, p *params) (string, error) {
+	if value == nil {
+		return "null", nil
+	}
+	if isNative(column) {
+		if err := q.checkNative(column, 0); err != nil {
+			return "", err
+		}
+		buf, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return "array(select jsonb_array_elements_text(" + p.add(string(buf)) + "::jsonb))::" + q.compileType(column.Type) + "[]", nil
+	}
+	if column.IsArray || column.Type == source.TypeObject || column.Type == source.TypeJSON {
+		buf, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return p.add(string(buf)), nil
+	}
+	switch n := value.(type) {
+	case float64:
+		if column.Type == source.TypeInteger {
+			return p.add(int64(n)), nil
+		}
+	case json.Number:
+		if i, err := n.Int64(); err == nil && column.Type == source.TypeInteger {
+			return p.add(i), nil
+		}
+		return p.add(n.String()), nil
+	}
+	return p.add(value), nil
+}
@@ -0,0 +1,82 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+)
+
+// WithVersion set expected values of version column of source, e.g. from If-Match header.
+// Update and delete change only rows with one of them
+func (q *Query) WithVersion(versions ...string) *Query {
+	q.versions = versions
+	return q
+}
+
+// Versions returns expected values of version column
+func (q *Query) Versions() []string {
+	return q.versions
+}
+
+// compileVersionGuard returns check that version column has one of expected values, nothing if they are not set
+func (q *Query) compileVersionGuard(p *params) (string, error) {
+	if len(q.versions) == 0 {
+		return "", nil
+	}
+	column := q.source.Cols[q.source.Version]
+	if column == nil {
+		return "", errors.New("version column of source is not defined")
+	}
+	values := make([]string, len(q.versions))
+	for i, version := range q.versions {
+		value, err := versionValue(column, version)
+		if err != nil {
+			return "", err
+		}
+		values[i] = p.add(value)
+	}
+	if len(values) == 1 {
+		return q.compileColumn(column) + " = " + values[0], nil
+	}
+	return q.compileColumn(column) + " in (" + strings.Join(values, ", ") + ")", nil
+}
+
+// versionValue returns argument of version column parsed from s
+func versionValue(column *source.Col, s string) (interface{}, error) {
+	switch column.Type {
+	case source.TypeInteger:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+	case source.TypeNumber:
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n, nil
+		}
+	case source.TypeTime:
+		if checkJSONString(column, "version", s) == nil {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("version must be %v not %q", column.Type, s)
+}
+
+// compileVersionBump returns assignment that changes version column: integer and number are incremented,
+// time is set to now. Returns nothing if source has no version column
+func (q *Query) compileVersionBump() (string, error) {
+	column := q.source.Cols[q.source.Version]
+	if column == nil {
+		return "", nil
+	}
+	if column.Type == source.TypeTime {
+		now, err := q.compileTimeExpr(ast.NewIdent("now", 0))
+		if err != nil {
+			return "", err
+		}
+		return column.DBName + " = " + now, nil
+	}
+	return column.DBName + " = " + q.compileColumn(column) + " + 1", nil
+}
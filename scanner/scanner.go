@@ -55,6 +55,7 @@ func (s *Scanner) scanIdentifier() string {
 }
 
 // scanNumber return token.Token consisting of decimal digits and/or dot
+// or interval consisting of decimal digits and unit
 func (s *Scanner) scanNumber() (token.Token, string) {
 	offs := s.offset
 	tok := token.ILLEGAL
@@ -67,6 +68,10 @@ func (s *Scanner) scanNumber() (token.Token, string) {
 		}
 		s.next()
 	}
+	if tok == token.INT && isIntervalUnit(s.ch) && !isLetter(s.peek()) && !isDigit(s.peek()) {
+		s.next()
+		tok = token.INTERVAL
+	}
 	return tok, string(s.src[offs:s.offset])
 }
 
@@ -87,6 +92,17 @@ func isLetter(ch rune) bool {
 	return (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || ch == '_'
 }
 
+// isIntervalUnit return true if character is one of interval units:
+// s (seconds), m (minutes), h (hours), d (days), w (weeks), M (months) or y (years)
+func isIntervalUnit(ch rune) bool {
+	switch ch {
+	case 's', 'm', 'h', 'd', 'w', 'M', 'y':
+		return true
+	default:
+		return false
+	}
+}
+
 // isLetter return true if character is digit
 func isDigit(ch rune) bool {
 	return ch >= '0' && ch <= '9'
@@ -109,11 +125,16 @@ func (s *Scanner) Scan() (pos token.Pos, tok token.Token, lit string) {
 		case -1:
 			tok = token.EOF
 		case '$':
-			if isLetter(s.peek()) {
+			if s.peek() == '=' {
+				s.next()
+				tok = token.SUFFIX
+			} else if isLetter(s.peek()) {
 				s.next()
 				if lit = s.scanIdentifier(); lit != "" {
 					tok = token.PSEUDO
 				}
+				// scanIdentifier already moved to the next character
+				return
 			} else {
 				pos = token.Pos(s.offset + 1)
 			}
@@ -150,7 +171,33 @@ func (s *Scanner) Scan() (pos token.Pos, tok token.Token, lit string) {
 				tok = token.GTR
 			}
 		case '=':
-			tok = token.EQL
+			if s.peek() == '~' {
+				s.next()
+				tok = token.REGEX
+			} else {
+				tok = token.EQL
+			}
+		case '~':
+			if s.peek() == '=' {
+				s.next()
+				tok = token.LIKE
+			} else if s.peek() == '*' {
+				s.next()
+				if s.peek() == '=' {
+					s.next()
+					tok = token.ILIKE
+				}
+			}
+		case '^':
+			if s.peek() == '=' {
+				s.next()
+				tok = token.PREFIX
+			}
+		case '*':
+			if s.peek() == '=' {
+				s.next()
+				tok = token.IEQL
+			}
 		case '!':
 			if s.peek() == '=' {
 				s.next()
@@ -163,7 +210,12 @@ func (s *Scanner) Scan() (pos token.Pos, tok token.Token, lit string) {
 		case '|':
 			tok = token.OR
 		case '@':
-			tok = token.AT
+			if s.peek() == '@' {
+				s.next()
+				tok = token.MATCH
+			} else {
+				tok = token.AT
+			}
 		case '?':
 			tok = token.QUERY
 		case '/':
@@ -36,6 +36,12 @@ var cases = []struct {
 	{Name: "Float", Src: " 1.23+", Pos: 1, Tok: token.FLOAT, Lit: "1.23"},
 	{Name: "Float", Src: "1.23.45", Pos: 0, Tok: token.FLOAT, Lit: "1.23"},
 
+	{Name: "Interval", Src: "7d", Pos: 0, Tok: token.INTERVAL, Lit: "7d"},
+	{Name: "Interval", Src: "1M+", Pos: 0, Tok: token.INTERVAL, Lit: "1M"},
+	{Name: "Interval", Src: " 12h", Pos: 1, Tok: token.INTERVAL, Lit: "12h"},
+	{Name: "Interval", Src: "12hours", Pos: 0, Tok: token.INT, Lit: "12"},
+	{Name: "Interval", Src: "1.5h", Pos: 0, Tok: token.FLOAT, Lit: "1.5"},
+
 	{Name: "String", Src: `"foo"`, Pos: 0, Tok: token.STRING, Lit: "foo"},
 	{Name: "String", Src: ` "foo"`, Pos: 1, Tok: token.STRING, Lit: "foo"},
 	{Name: "String", Src: `"foo`, Pos: 4, Tok: token.ILLEGAL, Lit: ""},
@@ -43,6 +49,7 @@ var cases = []struct {
 	{Name: "Pseudo field", Src: "$foo", Pos: 0, Tok: token.PSEUDO, Lit: "foo"},
 	{Name: "Pseudo field", Src: " $foo", Pos: 1, Tok: token.PSEUDO, Lit: "foo"},
 	{Name: "Pseudo field", Src: "$foo ", Pos: 0, Tok: token.PSEUDO, Lit: "foo"},
+	{Name: "Pseudo field", Src: "$foo=", Pos: 0, Tok: token.PSEUDO, Lit: "foo"},
 	{Name: "Pseudo field", Src: "$", Pos: 1, Tok: token.ILLEGAL, Lit: ""},
 	{Name: "Pseudo field", Src: " $", Pos: 2, Tok: token.ILLEGAL, Lit: ""},
 	{Name: "Pseudo field", Src: " $ ", Pos: 2, Tok: token.ILLEGAL, Lit: ""},
@@ -71,6 +78,14 @@ var cases = []struct {
 	{Name: "Less or equal", Src: "<=", Pos: 0, Tok: token.LEQ, Lit: ""},
 	{Name: "Greater", Src: ">", Pos: 0, Tok: token.GTR, Lit: ""},
 	{Name: "Greater or equal", Src: ">=", Pos: 0, Tok: token.GEQ, Lit: ""},
+	{Name: "Like", Src: "~=", Pos: 0, Tok: token.LIKE, Lit: ""},
+	{Name: "Case-insensitive like", Src: "~*=", Pos: 0, Tok: token.ILIKE, Lit: ""},
+	{Name: "Case-insensitive like", Src: "~*", Pos: 0, Tok: token.ILLEGAL, Lit: ""},
+	{Name: "Prefix", Src: "^=", Pos: 0, Tok: token.PREFIX, Lit: ""},
+	{Name: "Suffix", Src: "$=", Pos: 0, Tok: token.SUFFIX, Lit: ""},
+	{Name: "Case-insensitive equal", Src: "*=", Pos: 0, Tok: token.IEQL, Lit: ""},
+	{Name: "Regex", Src: "=~", Pos: 0, Tok: token.REGEX, Lit: ""},
+	{Name: "Match", Src: "@@", Pos: 0, Tok: token.MATCH, Lit: ""},
 }
 
 func TestScan(t *testing.T) {
@@ -117,3 +132,14 @@ func TestPeek(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestScanSequence(t *testing.T) {
+	var s Scanner
+	s.Init([]rune(`$foo="a"`))
+	for _, expected := range []token.Token{token.PSEUDO, token.EQL, token.STRING, token.EOF} {
+		if _, tok, _ := s.Scan(); tok != expected {
+			t.Errorf("expected token: %q, got: %q", expected, tok)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Override changes column built by introspection
+type Override struct {
+	Name     string   // name of column in queries, db name by default
+	Children Cols     // children of JSON column
+	Array    bool     // JSON column contains array
+	Skip     bool     // column is not exposed
+	Enum     []string // values of enum column of unsupported type, e.g. user-defined enum of postgres
+}
+
+// IntrospectPostgres returns Source with columns of table or view read from information_schema,
+// table may be qualified by schema like public.orders, overrides are keyed by db names of columns
+func IntrospectPostgres(ctx context.Context, db *sql.DB, table string, overrides map[string]Override) (*Source, error) {
+	query := "select column_name, data_type, udt_name from information_schema.columns where table_schema = current_schema() and table_name = $1 order by ordinal_position"
+	args := []interface{}{table}
+	if i := strings.Index(table, "."); i >= 0 {
+		query = "select column_name, data_type, udt_name from information_schema.columns where table_schema = $1 and table_name = $2 order by ordinal_position"
+		args = []interface{}{table[:i], table[i+1:]}
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to introspect %v: %v", table, err)
+	}
+	defer rows.Close()
+
+	cols := Cols{}
+	for rows.Next() {
+		var name, dataType, udtName string
+		if err := rows.Scan(&name, &dataType, &udtName); err != nil {
+			return nil, fmt.Errorf("unable to introspect %v: %v", table, err)
+		}
+		isArray := dataType == "ARRAY"
+		if isArray {
+			// udt name of array is a name of element type with underscore, e.g. _int4
+			dataType = strings.TrimPrefix(udtName, "_")
+		} else if dataType == "USER-DEFINED" {
+			// udt name of extension type or enum, e.g. citext
+			dataType = udtName
+		}
+		datatype, ok := postgresDatatype(dataType)
+		if err := addIntrospected(cols, name, datatype, ok, isArray, dataType, overrides); err != nil {
+			return nil, fmt.Errorf("unable to introspect %v: %v", table, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to introspect %v: %v", table, err)
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("unable to introspect %v: table is not found", table)
+	}
+	return &Source{Cols: cols}, nil
+}
+
+// IntrospectSQLite returns Source with columns of table read by PRAGMA table_info,
+// overrides are keyed by db names of columns
+func IntrospectSQLite(ctx context.Context, db *sql.DB, table string, overrides map[string]Override) (*Source, error) {
+	rows, err := db.QueryContext(ctx, `pragma table_info("`+strings.Replace(table, `"`, `""`, -1)+`")`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to introspect %v: %v", table, err)
+	}
+	defer rows.Close()
+
+	cols := Cols{}
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, sqlType    string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &sqlType, &notNull, &dflt, &pk); err != nil {
+			return nil, fmt.Errorf("unable to introspect %v: %v", table, err)
+		}
+		datatype, ok := sqliteDatatype(sqlType)
+		if err := addIntrospected(cols, name, datatype, ok, false, sqlType, overrides); err != nil {
+			return nil, fmt.Errorf("unable to introspect %v: %v", table, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to introspect %v: %v", table, err)
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("unable to introspect %v: table is not found", table)
+	}
+	return &Source{Cols: cols}, nil
+}
+
+// addIntrospected adds column to cols applying override
+func addIntrospected(cols Cols, dbName string, datatype Datatype, ok, isArray bool, sqlType string, overrides map[string]Override) error {
+	override := overrides[dbName]
+	if override.Skip {
+		return nil
+	}
+	if override.Enum != nil {
+		datatype, ok = TypeEnum, true
+	}
+	if !ok {
+		return fmt.Errorf("column %v has unsupported type %v", dbName, sqlType)
+	}
+	name := dbName
+	if override.Name != "" {
+		name = override.Name
+	}
+	col := NewCol(datatype, name, dbName, isArray)
+	if override.Enum != nil {
+		col.WithValues(override.Enum...)
+	}
+	if override.Children != nil || override.Array {
+		if datatype != TypeJSON {
+			return fmt.Errorf("column %v of type %v can not have children", dbName, sqlType)
+		}
+		// JSON with known children is an object
+		col.Type = TypeObject
+		col.WithChildren(override.Children)
+		col.IsArray = col.IsArray || override.Array
+	} else if isArray {
+		col.Storage = StorageArray
+	}
+	if _, exists := cols[name]; exists {
+		return fmt.Errorf("column %v is already defined", name)
+	}
+	cols[name] = col
+	return nil
+}
+
+// postgresDatatype returns datatype of postgres type from information_schema or udt name of array element
+func postgresDatatype(sqlType string) (Datatype, bool) {
+	switch strings.ToLower(sqlType) {
+	case "smallint", "integer", "bigint", "int2", "int4", "int8":
+		return TypeInteger, true
+	case "numeric", "decimal":
+		return TypeDecimal, true
+	case "real", "double precision", "money", "float4", "float8":
+		return TypeNumber, true
+	case "text", "character varying", "character", "varchar", "bpchar", "char", "name", "citext":
+		return TypeString, true
+	case "uuid":
+		return TypeUUID, true
+	case "boolean", "bool":
+		return TypeBool, true
+	case "date":
+		return TypeDate, true
+	case "timestamp", "timestamptz", "timestamp without time zone", "timestamp with time zone":
+		return TypeTime, true
+	case "interval":
+		return TypeInterval, true
+	case "json", "jsonb":
+		return TypeJSON, true
+	default:
+		return 0, false
+	}
+}
+
+// sqliteDatatype returns datatype of declared sqlite type using rules of type affinity
+func sqliteDatatype(sqlType string) (Datatype, bool) {
+	t := strings.ToUpper(sqlType)
+	switch {
+	case strings.Contains(t, "BOOL"):
+		return TypeBool, true
+	case strings.Contains(t, "TIME"):
+		return TypeTime, true
+	case strings.Contains(t, "DATE"):
+		return TypeDate, true
+	case strings.Contains(t, "JSON"):
+		return TypeJSON, true
+	case strings.Contains(t, "INT"):
+		return TypeInteger, true
+	case strings.Contains(t, "NUMERIC"), strings.Contains(t, "DECIMAL"):
+		return TypeDecimal, true
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return TypeNumber, true
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return TypeString, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,197 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeDriver returns rows of the first table whose key is a prefix of query
+type fakeDriver struct {
+	tables map[string][][]driver.Value
+	query  string
+	args   []driver.Value
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+type fakeConn struct{ driver *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.driver, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	driver *fakeDriver
+	query  string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.driver.query, s.driver.args = s.query, args
+	for key, rows := range s.driver.tables {
+		if strings.HasPrefix(s.query, key) {
+			return &fakeRows{rows: rows}, nil
+		}
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	i    int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.i])
+	r.i++
+	return nil
+}
+
+var fake = &fakeDriver{}
+
+func init() {
+	sql.Register("w3sqlfake", fake)
+}
+
+func TestIntrospectPostgres(t *testing.T) {
+	fake.tables = map[string][][]driver.Value{
+		"select column_name": {
+			{"id", "bigint", "int8"},
+			{"full_name", "character varying", "varchar"},
+			{"active", "boolean", "bool"},
+			{"created_at", "timestamp with time zone", "timestamptz"},
+			{"birthday", "date", "date"},
+			{"token", "uuid", "uuid"},
+			{"balance", "numeric", "numeric"},
+			{"tags", "ARRAY", "_text"},
+			{"address", "jsonb", "jsonb"},
+			{"meta", "json", "json"},
+			{"email", "USER-DEFINED", "citext"},
+			{"status", "USER-DEFINED", "order_status"},
+			{"secret", "bytea", "bytea"},
+		},
+	}
+	db, err := sql.Open("w3sqlfake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s, err := IntrospectPostgres(context.Background(), db, "public.customers", map[string]Override{
+		"full_name": {Name: "fullName"},
+		"address":   {Children: NewCols(NewCol(TypeString, "city", "city", false))},
+		"status":    {Enum: []string{"new", "paid"}},
+		"secret":    {Skip: true},
+	})
+	if err != nil {
+		t.Errorf("expected err: %v, got: %v", nil, err)
+		t.FailNow()
+	}
+	if !reflect.DeepEqual(fake.args, []driver.Value{"public", "customers"}) {
+		t.Errorf("expected args: %v, got: %v", []string{"public", "customers"}, fake.args)
+		t.Fail()
+	}
+	expected := NewCols(
+		NewCol(TypeInteger, "id", "id", false),
+		NewCol(TypeString, "fullName", "full_name", false),
+		NewCol(TypeBool, "active", "active", false),
+		NewCol(TypeTime, "created_at", "created_at", false),
+		NewCol(TypeDate, "birthday", "birthday", false),
+		NewCol(TypeUUID, "token", "token", false),
+		NewCol(TypeDecimal, "balance", "balance", false),
+		NewCol(TypeString, "tags", "tags", true).WithStorage(StorageArray),
+		NewCol(TypeObject, "address", "address", false).WithChildren(NewCols(NewCol(TypeString, "city", "city", false))),
+		NewCol(TypeJSON, "meta", "meta", false),
+		NewCol(TypeString, "email", "email", false),
+		NewCol(TypeEnum, "status", "status", false).WithValues("new", "paid"),
+	)
+	if !reflect.DeepEqual(s.Cols, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, s.Cols)
+		t.Fail()
+	}
+
+	if s, err := IntrospectPostgres(context.Background(), db, "customers", nil); err == nil {
+		t.Errorf("expected error for unsupported type, got: %v", s)
+		t.Fail()
+	}
+	if s, err := IntrospectPostgres(context.Background(), db, "customers", map[string]Override{"secret": {Skip: true}}); err == nil {
+		t.Errorf("expected error for user-defined type, got: %v", s)
+		t.Fail()
+	}
+	fake.tables = nil
+	if s, err := IntrospectPostgres(context.Background(), db, "customers", nil); err == nil {
+		t.Errorf("expected error for unknown table, got: %v", s)
+		t.Fail()
+	}
+}
+
+func TestIntrospectSQLite(t *testing.T) {
+	fake.tables = map[string][][]driver.Value{
+		"pragma table_info": {
+			{int64(0), "id", "INTEGER", int64(1), nil, int64(1)},
+			{int64(1), "name", "VARCHAR(255)", int64(0), nil, int64(0)},
+			{int64(2), "price", "DECIMAL(10,2)", int64(0), "0", int64(0)},
+			{int64(3), "paid", "BOOLEAN", int64(0), nil, int64(0)},
+			{int64(4), "created_at", "DATETIME", int64(0), nil, int64(0)},
+			{int64(5), "items", "JSON", int64(0), nil, int64(0)},
+			{int64(6), "shipped", "DATE", int64(0), nil, int64(0)},
+			{int64(7), "meta", "JSON", int64(0), nil, int64(0)},
+		},
+	}
+	db, err := sql.Open("w3sqlfake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s, err := IntrospectSQLite(context.Background(), db, "orders", map[string]Override{
+		"items": {Array: true, Children: NewCols(NewCol(TypeString, "sku", "sku", false))},
+	})
+	if err != nil {
+		t.Errorf("expected err: %v, got: %v", nil, err)
+		t.FailNow()
+	}
+	if fake.query != `pragma table_info("orders")` {
+		t.Errorf("expected query: %v, got: %v", `pragma table_info("orders")`, fake.query)
+		t.Fail()
+	}
+	expected := NewCols(
+		NewCol(TypeInteger, "id", "id", false),
+		NewCol(TypeString, "name", "name", false),
+		NewCol(TypeDecimal, "price", "price", false),
+		NewCol(TypeBool, "paid", "paid", false),
+		NewCol(TypeTime, "created_at", "created_at", false),
+		NewCol(TypeObject, "items", "items", true).WithChildren(NewCols(NewCol(TypeString, "sku", "sku", false))),
+		NewCol(TypeDate, "shipped", "shipped", false),
+		NewCol(TypeJSON, "meta", "meta", false),
+	)
+	if !reflect.DeepEqual(s.Cols, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, s.Cols)
+		t.Fail()
+	}
+
+	if s, err := IntrospectSQLite(context.Background(), db, "orders", map[string]Override{"name": {Array: true}}); err == nil {
+		t.Errorf("expected error for children of not JSON column, got: %v", s)
+		t.Fail()
+	}
+}
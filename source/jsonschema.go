@@ -0,0 +1,75 @@
+package source
+
+import "sort"
+
+// JSONSchema is a JSON Schema of value
+type JSONSchema struct {
+	Type       string                 `json:"type,omitempty"`
+	Format     string                 `json:"format,omitempty"`
+	Items      *JSONSchema            `json:"items,omitempty"`
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	Enum       []string               `json:"enum,omitempty"`
+	ReadOnly   bool                   `json:"readOnly,omitempty"`
+}
+
+// JSONSchema returns JSON Schema of row of source, hidden and not selectable columns are omitted
+func (s *Source) JSONSchema() *JSONSchema {
+	return objectSchema(s.Cols)
+}
+
+// JSONSchema returns JSON Schema of column value
+func (c *Col) JSONSchema() *JSONSchema {
+	var schema *JSONSchema
+	switch c.Type {
+	case TypeNumber:
+		schema = &JSONSchema{Type: "number"}
+	case TypeString:
+		schema = &JSONSchema{Type: "string"}
+	case TypeBool:
+		schema = &JSONSchema{Type: "boolean"}
+	case TypeTime:
+		schema = &JSONSchema{Type: "string", Format: "date-time"}
+	case TypeObject:
+		schema = objectSchema(c.Children)
+	case TypeInteger:
+		schema = &JSONSchema{Type: "integer"}
+	case TypeDecimal:
+		schema = &JSONSchema{Type: "number"}
+	case TypeDate:
+		schema = &JSONSchema{Type: "string", Format: "date"}
+	case TypeUUID:
+		schema = &JSONSchema{Type: "string", Format: "uuid"}
+	case TypeEnum:
+		schema = &JSONSchema{Type: "string", Enum: c.Values}
+	case TypeInterval:
+		schema = &JSONSchema{Type: "string"}
+	default:
+		schema = &JSONSchema{}
+	}
+	if c.IsArray {
+		schema = &JSONSchema{Type: "array", Items: schema}
+	}
+	schema.ReadOnly = c.Expr != ""
+	return schema
+}
+
+// objectSchema returns JSON Schema of object with properties of columns
+func objectSchema(cols Cols) *JSONSchema {
+	schema := &JSONSchema{Type: "object"}
+	if len(cols) == 0 {
+		return schema
+	}
+	schema.Properties = make(map[string]*JSONSchema, len(cols))
+	for name, col := range cols {
+		if !col.Allows(Selectable) {
+			continue
+		}
+		schema.Properties[name] = col.JSONSchema()
+		if col.Required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
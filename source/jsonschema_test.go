@@ -0,0 +1,43 @@
+package source
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	s := &Source{
+		Cols: NewCols(
+			&Col{Type: TypeNumber, Name: "id", DBName: "id", Required: true},
+			NewCol(TypeString, "tags", "tags", true),
+			NewCol(TypeTime, "createdAt", "created_at", false),
+			NewCol(TypeObject, "items", "items", true).WithChildren(NewCols(
+				NewCol(TypeString, "sku", "sku", false),
+				NewCol(TypeBool, "gift", "gift", false),
+			)),
+			NewCol(TypeObject, "meta", "meta", false),
+			NewCol(TypeDate, "birthday", "birthday", false),
+			NewCol(TypeString, "password", "password", false).WithHidden(),
+			NewCol(TypeString, "phone", "phone", false).WithDenied(Selectable),
+			NewCol(TypeEnum, "status", "status", false).WithValues("new", "paid"),
+		),
+	}
+	buf, err := json.Marshal(s.JSONSchema())
+	if err != nil {
+		t.Errorf("expected err: %v, got: %v", nil, err)
+		t.FailNow()
+	}
+	expected := `{"type":"object","properties":{` +
+		`"birthday":{"type":"string","format":"date"},` +
+		`"createdAt":{"type":"string","format":"date-time"},` +
+		`"id":{"type":"number"},` +
+		`"items":{"type":"array","items":{"type":"object","properties":{"gift":{"type":"boolean"},"sku":{"type":"string"}}}},` +
+		`"meta":{"type":"object"},` +
+		`"status":{"type":"string","enum":["new","paid"]},` +
+		`"tags":{"type":"array","items":{"type":"string"}}},` +
+		`"required":["id"]}`
+	if string(buf) != expected {
+		t.Errorf("expected: %v, got: %v", expected, string(buf))
+		t.Fail()
+	}
+}
@@ -0,0 +1,341 @@
+package source
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema is a document that describes Source, e.g. in JSON or YAML config file
+type Schema struct {
+	Columns []ColSchema   `json:"columns" yaml:"columns"`
+	Search  *SearchSchema `json:"search,omitempty" yaml:"search,omitempty"`
+	Version string        `json:"version,omitempty" yaml:"version,omitempty"` // column of optimistic concurrency
+	Deleted string        `json:"deleted,omitempty" yaml:"deleted,omitempty"` // time column of soft delete
+}
+
+// ColSchema describes a column
+type ColSchema struct {
+	Name     string              `json:"name" yaml:"name"`
+	DB       string              `json:"db,omitempty" yaml:"db,omitempty"` // name of column by default
+	Type     string              `json:"type" yaml:"type"`
+	Array    bool                `json:"array,omitempty" yaml:"array,omitempty"`
+	Required bool                `json:"required,omitempty" yaml:"required,omitempty"`
+	Regex    bool                `json:"regex,omitempty" yaml:"regex,omitempty"`   // allows regular expression matching
+	Scale    int                 `json:"scale,omitempty" yaml:"scale,omitempty"`   // of decimal
+	Values   []string            `json:"values,omitempty" yaml:"values,omitempty"` // of enum
+	Deny     []string            `json:"deny,omitempty" yaml:"deny,omitempty"`     // denied capabilities: filter, sort, select or write
+	Roles    map[string][]string `json:"roles,omitempty" yaml:"roles,omitempty"`   // capabilities allowed for roles, all roles if empty
+	Hidden   bool                `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+	Expr     string              `json:"expr,omitempty" yaml:"expr,omitempty"`       // SQL expression of computed column
+	Storage  string              `json:"storage,omitempty" yaml:"storage,omitempty"` // json by default, array or table
+	Table    *TableSchema        `json:"table,omitempty" yaml:"table,omitempty"`     // child table of table storage
+	Children []ColSchema         `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+// TableSchema describes child table of column
+type TableSchema struct {
+	Name       string `json:"name" yaml:"name"`
+	Key        string `json:"key" yaml:"key"`               // name of column of source
+	ForeignKey string `json:"foreignKey" yaml:"foreignKey"` // db name of column of child table
+}
+
+// SearchSchema describes full-text search over source
+type SearchSchema struct {
+	Config  string   `json:"config,omitempty" yaml:"config,omitempty"`
+	Columns []string `json:"columns,omitempty" yaml:"columns,omitempty"`
+	Vector  string   `json:"vector,omitempty" yaml:"vector,omitempty"`
+}
+
+// datatypes contains names of datatypes in schema
+var datatypes = map[string]Datatype{
+	"number":   TypeNumber,
+	"string":   TypeString,
+	"boolean":  TypeBool,
+	"time":     TypeTime,
+	"object":   TypeObject,
+	"integer":  TypeInteger,
+	"decimal":  TypeDecimal,
+	"date":     TypeDate,
+	"uuid":     TypeUUID,
+	"enum":     TypeEnum,
+	"interval": TypeInterval,
+	"json":     TypeJSON,
+}
+
+// storages contains names of storages in schema
+var storages = map[string]Storage{
+	"json":  StorageJSON,
+	"array": StorageArray,
+	"table": StorageTable,
+}
+
+// String returns name of storage in schema
+func (s Storage) String() string {
+	for name, storage := range storages {
+		if storage == s {
+			return name
+		}
+	}
+	return fmt.Sprintf("Storage(%d)", int(s))
+}
+
+// String returns name of datatype in schema
+func (d Datatype) String() string {
+	for name, t := range datatypes {
+		if t == d {
+			return name
+		}
+	}
+	return fmt.Sprintf("Datatype(%d)", int(d))
+}
+
+// ParseDatatype returns datatype by name in schema
+func ParseDatatype(name string) (Datatype, error) {
+	if t, ok := datatypes[name]; ok {
+		return t, nil
+	}
+	names := make([]string, 0, len(datatypes))
+	for n := range datatypes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return 0, fmt.Errorf("unknown type %q, expected one of %v", name, strings.Join(names, ", "))
+}
+
+// Load returns Source from schema document decoded by unmarshal, e.g. yaml.Unmarshal
+func Load(data []byte, unmarshal func([]byte, interface{}) error) (*Source, error) {
+	var schema Schema
+	if err := unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return schema.Source()
+}
+
+// LoadJSON returns Source from JSON schema document, unknown keys are not allowed
+func LoadJSON(data []byte) (*Source, error) {
+	return Load(data, func(data []byte, v interface{}) error {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(v)
+	})
+}
+
+// Source validates schema and returns Source
+func (s *Schema) Source() (*Source, error) {
+	var errs []string
+	cols := colsOfSchema(s.Columns, "columns", "", false, &errs)
+	var search *Search
+	if s.Search != nil {
+		search = &Search{Config: s.Search.Config, Cols: s.Search.Columns, Vector: s.Search.Vector}
+		for i, name := range s.Search.Columns {
+			col := cols.ByName(name)
+			if col == nil {
+				errs = append(errs, fmt.Sprintf("search.columns[%d]: column %q is not defined", i, name))
+			} else if col.Type != TypeString || col.IsArray {
+				errs = append(errs, fmt.Sprintf("search.columns[%d]: column %q must be string", i, name))
+			}
+		}
+	}
+	if s.Version != "" {
+		col := cols[s.Version]
+		if col == nil {
+			errs = append(errs, fmt.Sprintf("version: column %q is not defined", s.Version))
+		} else if (col.Type != TypeInteger && col.Type != TypeNumber && col.Type != TypeTime) || col.IsArray || col.Expr != "" {
+			errs = append(errs, fmt.Sprintf("version: column %q must be stored integer, number or time", s.Version))
+		}
+	}
+	if s.Deleted != "" {
+		col := cols[s.Deleted]
+		if col == nil {
+			errs = append(errs, fmt.Sprintf("deleted: column %q is not defined", s.Deleted))
+		} else if col.Type != TypeTime || col.IsArray || col.Expr != "" {
+			errs = append(errs, fmt.Sprintf("deleted: column %q must be stored time", s.Deleted))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.New("invalid schema: " + strings.Join(errs, "; "))
+	}
+	return &Source{Cols: cols, Search: search, Version: s.Version, Deleted: s.Deleted}, nil
+}
+
+// colsOfSchema returns columns and appends validation errors to errs,
+// path is location in document like columns[1].children[0], prefix is name of parent column
+// and inJSON is true for children of JSON column
+func colsOfSchema(schemas []ColSchema, path, prefix string, inJSON bool, errs *[]string) Cols {
+	cols := Cols{}
+	for i, schema := range schemas {
+		location := fmt.Sprintf("%v[%d]", path, i)
+		if schema.Name != "" {
+			location += " (" + prefix + schema.Name + ")"
+		}
+		if !isName(schema.Name) {
+			*errs = append(*errs, fmt.Sprintf("%v: name %q must consist of latin letters, digits and underscores", location, schema.Name))
+			continue
+		}
+		if _, ok := cols[schema.Name]; ok {
+			*errs = append(*errs, fmt.Sprintf("%v: column %q is already defined", location, schema.Name))
+			continue
+		}
+		datatype, err := ParseDatatype(schema.Type)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%v: %v", location, err))
+			continue
+		}
+		dbName := schema.DB
+		if dbName == "" {
+			dbName = schema.Name
+		}
+		col := NewCol(datatype, schema.Name, dbName, schema.Array)
+		col.Required = schema.Required
+		col.Regex = schema.Regex
+		col.Scale = schema.Scale
+		col.Values = schema.Values
+		col.Hidden = schema.Hidden
+		col.Expr = schema.Expr
+		if schema.Expr != "" && (schema.DB != "" || len(schema.Children) > 0) {
+			*errs = append(*errs, fmt.Sprintf("%v: computed column can not have db name or children", location))
+		}
+		for j, name := range schema.Deny {
+			capability, ok := ParseCapability(name)
+			if !ok {
+				*errs = append(*errs, fmt.Sprintf("%v: deny[%d]: unknown capability %q, expected one of filter, select, sort, write", location, j, name))
+			}
+			col.Denied |= capability
+		}
+		for role, names := range schema.Roles {
+			col.WithRole(role, 0)
+			for j, name := range names {
+				capability, ok := ParseCapability(name)
+				if !ok {
+					*errs = append(*errs, fmt.Sprintf("%v: roles.%v[%d]: unknown capability %q, expected one of filter, select, sort, write", location, role, j, name))
+				}
+				col.WithRole(role, capability)
+			}
+		}
+		if schema.Regex && datatype != TypeString {
+			*errs = append(*errs, fmt.Sprintf("%v: regex is allowed for string columns only", location))
+		}
+		if schema.Scale != 0 && (datatype != TypeDecimal || schema.Scale < 0) {
+			*errs = append(*errs, fmt.Sprintf("%v: scale must be positive and is allowed for decimal columns only", location))
+		}
+		if (len(schema.Values) > 0) != (datatype == TypeEnum) {
+			*errs = append(*errs, fmt.Sprintf("%v: values are required for enum columns and allowed for them only", location))
+		}
+		if schema.Storage != "" {
+			storage, ok := storages[schema.Storage]
+			switch {
+			case !ok:
+				*errs = append(*errs, fmt.Sprintf("%v: unknown storage %q, expected one of array, json, table", location, schema.Storage))
+			case storage != StorageJSON && inJSON:
+				*errs = append(*errs, fmt.Sprintf("%v: children of json column must be stored as json", location))
+			case storage == StorageArray && (!schema.Array || datatype == TypeObject):
+				*errs = append(*errs, fmt.Sprintf("%v: array storage is allowed for arrays of scalars only", location))
+			case storage == StorageTable && datatype != TypeObject:
+				*errs = append(*errs, fmt.Sprintf("%v: table storage is allowed for object columns only", location))
+			case storage == StorageTable && (schema.Table == nil || schema.Table.Name == "" || schema.Table.Key == "" || schema.Table.ForeignKey == ""):
+				*errs = append(*errs, fmt.Sprintf("%v: table storage requires table with name, key and foreignKey", location))
+			}
+			col.Storage = storage
+		}
+		if schema.Table != nil {
+			if col.Storage != StorageTable {
+				*errs = append(*errs, fmt.Sprintf("%v: table is allowed for table storage only", location))
+			}
+			col.Child = &ChildTable{Table: schema.Table.Name, Key: schema.Table.Key, ForeignKey: schema.Table.ForeignKey}
+		}
+		if len(schema.Children) > 0 {
+			if datatype != TypeObject {
+				*errs = append(*errs, fmt.Sprintf("%v: children are allowed for object columns only", location))
+			}
+			childrenInJSON := col.Storage != StorageTable
+			col.WithChildren(colsOfSchema(schema.Children, fmt.Sprintf("%v[%d].children", path, i), prefix+schema.Name+".", childrenInJSON, errs))
+		}
+		cols[col.Name] = col
+	}
+	return cols
+}
+
+// isName returns true if name consists of latin letters, digits and underscores
+func isName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, ch := range name {
+		if !(ch >= 'A' && ch <= 'Z') && !(ch >= 'a' && ch <= 'z') && !(ch >= '0' && ch <= '9') && ch != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// SchemaOf returns schema of Source, columns are sorted by name
+func SchemaOf(s *Source) *Schema {
+	schema := &Schema{Columns: schemaOfCols(s.Cols), Version: s.Version, Deleted: s.Deleted}
+	if s.Search != nil {
+		schema.Search = &SearchSchema{Config: s.Search.Config, Columns: s.Search.Cols, Vector: s.Search.Vector}
+	}
+	return schema
+}
+
+// schemaOfCols returns schemas of columns sorted by name
+func schemaOfCols(cols Cols) []ColSchema {
+	names := make([]string, 0, len(cols))
+	for name := range cols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	schemas := make([]ColSchema, len(names))
+	for i, name := range names {
+		col := cols[name]
+		schemas[i] = ColSchema{
+			Name:     col.Name,
+			Type:     col.Type.String(),
+			Array:    col.IsArray,
+			Required: col.Required,
+			Regex:    col.Regex,
+			Scale:    col.Scale,
+			Values:   col.Values,
+			Hidden:   col.Hidden,
+			Expr:     col.Expr,
+			Children: schemaOfCols(col.Children),
+		}
+		if col.Storage != StorageJSON {
+			schemas[i].Storage = col.Storage.String()
+		}
+		if col.Child != nil {
+			schemas[i].Table = &TableSchema{Name: col.Child.Table, Key: col.Child.Key, ForeignKey: col.Child.ForeignKey}
+		}
+		if col.Denied != 0 {
+			schemas[i].Deny = strings.Split(col.Denied.String(), ",")
+		}
+		if col.Roles != nil {
+			schemas[i].Roles = make(map[string][]string, len(col.Roles))
+			for role, capabilities := range col.Roles {
+				schemas[i].Roles[role] = []string{}
+				if capabilities != 0 {
+					schemas[i].Roles[role] = strings.Split(capabilities.String(), ",")
+				}
+			}
+		}
+		if col.DBName != col.Name && col.Expr == "" {
+			schemas[i].DB = col.DBName
+		}
+	}
+	return schemas
+}
+
+// Dump returns schema document of Source encoded by marshal, e.g. yaml.Marshal
+func Dump(s *Source, marshal func(interface{}) ([]byte, error)) ([]byte, error) {
+	return marshal(SchemaOf(s))
+}
+
+// DumpJSON returns JSON schema document of Source
+func DumpJSON(s *Source) ([]byte, error) {
+	return Dump(s, func(v interface{}) ([]byte, error) {
+		return json.MarshalIndent(v, "", "  ")
+	})
+}
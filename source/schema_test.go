@@ -0,0 +1,186 @@
+package source
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+  "columns": [
+    {
+      "name": "address",
+      "db": "addr",
+      "type": "object",
+      "children": [
+        {
+          "name": "city",
+          "type": "string",
+          "regex": true,
+          "roles": {
+            "admin": [
+              "filter",
+              "sort",
+              "select",
+              "write"
+            ],
+            "support": [
+              "select"
+            ]
+          }
+        },
+        {
+          "name": "zip",
+          "type": "string",
+          "deny": [
+            "filter",
+            "sort"
+          ]
+        }
+      ]
+    },
+    {
+      "name": "deleted",
+      "type": "time",
+      "hidden": true
+    },
+    {
+      "name": "id",
+      "type": "number",
+      "required": true
+    },
+    {
+      "name": "items",
+      "type": "object",
+      "array": true,
+      "storage": "table",
+      "table": {
+        "name": "order_items",
+        "key": "id",
+        "foreignKey": "order_id"
+      },
+      "children": [
+        {
+          "name": "sku",
+          "type": "string"
+        }
+      ]
+    },
+    {
+      "name": "tags",
+      "type": "string",
+      "array": true
+    }
+  ],
+  "search": {
+    "config": "english",
+    "columns": [
+      "tags"
+    ]
+  },
+  "version": "id",
+  "deleted": "deleted"
+}`
+
+func TestLoadJSON(t *testing.T) {
+	s, err := LoadJSON([]byte(strings.Replace(testSchema, `"tags",
+      "type": "string",
+      "array": true`, `"tags",
+      "type": "string"`, 1)))
+	if err != nil {
+		t.Errorf("expected err: %v, got: %v", nil, err)
+		t.FailNow()
+	}
+	expected := &Source{
+		Cols: NewCols(
+			NewCol(TypeObject, "address", "addr", false).WithChildren(NewCols(
+				NewCol(TypeString, "city", "city", false).WithRegex().WithRole("admin", AllCapabilities).WithRole("support", Selectable),
+				NewCol(TypeString, "zip", "zip", false).WithDenied(Filterable|Sortable),
+			)),
+			NewCol(TypeTime, "deleted", "deleted", false).WithHidden(),
+			&Col{Type: TypeNumber, Name: "id", DBName: "id", Required: true},
+			NewCol(TypeObject, "items", "items", true).WithChildTable("order_items", "id", "order_id").WithChildren(NewCols(
+				NewCol(TypeString, "sku", "sku", false),
+			)),
+			NewCol(TypeString, "tags", "tags", false),
+		),
+		Search:  &Search{Config: "english", Cols: []string{"tags"}},
+		Version: "id",
+		Deleted: "deleted",
+	}
+	if !reflect.DeepEqual(s, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, s)
+		t.Fail()
+	}
+}
+
+func TestLoadJSONErrors(t *testing.T) {
+	cases := []struct {
+		Name  string
+		Src   string
+		Error string
+	}{
+		{Name: "Syntax", Src: `{"columns": [}`, Error: "invalid schema: invalid character"},
+		{Name: "Unknown key", Src: `{"columns": [{"name": "a", "type": "string", "requird": true}]}`, Error: `unknown field "requird"`},
+		{Name: "Unknown type", Src: `{"columns": [{"name": "a", "type": "strin"}]}`, Error: `columns[0] (a): unknown type "strin", expected one of boolean, date, decimal, enum, integer, interval, json, number, object, string, time, uuid`},
+		{Name: "Empty name", Src: `{"columns": [{"type": "string"}]}`, Error: `columns[0]: name "" must consist of`},
+		{Name: "Duplicate", Src: `{"columns": [{"name": "a", "type": "string"}, {"name": "a", "type": "number"}]}`, Error: `columns[1] (a): column "a" is already defined`},
+		{Name: "Children of not object", Src: `{"columns": [{"name": "a", "type": "string", "children": [{"name": "b", "type": "string"}]}]}`, Error: "columns[0] (a): children are allowed for object columns only"},
+		{Name: "Nested", Src: `{"columns": [{"name": "a", "type": "object", "children": [{"name": "b", "type": "number", "regex": true}]}]}`, Error: "columns[0].children[0] (a.b): regex is allowed for string columns only"},
+		{Name: "Computed with db", Src: `{"columns": [{"name": "a", "db": "a", "type": "string", "expr": "{q}.b || {q}.c"}]}`, Error: "columns[0] (a): computed column can not have db name or children"},
+		{Name: "Array storage of object", Src: `{"columns": [{"name": "a", "type": "object", "array": true, "storage": "array"}]}`, Error: "columns[0] (a): array storage is allowed for arrays of scalars only"},
+		{Name: "Table storage without table", Src: `{"columns": [{"name": "a", "type": "object", "storage": "table"}]}`, Error: "columns[0] (a): table storage requires table with name, key and foreignKey"},
+		{Name: "Table storage in json", Src: `{"columns": [{"name": "a", "type": "object", "children": [{"name": "b", "type": "object", "storage": "table", "table": {"name": "b", "key": "id", "foreignKey": "a_id"}}]}]}`, Error: "columns[0].children[0] (a.b): children of json column must be stored as json"},
+		{Name: "Unknown capability", Src: `{"columns": [{"name": "a", "type": "string", "deny": ["order"]}]}`, Error: `columns[0] (a): deny[0]: unknown capability "order"`},
+		{Name: "Unknown role capability", Src: `{"columns": [{"name": "a", "type": "string", "roles": {"support": ["read"]}}]}`, Error: `columns[0] (a): roles.support[0]: unknown capability "read"`},
+		{Name: "Scale of not decimal", Src: `{"columns": [{"name": "a", "type": "number", "scale": 2}]}`, Error: "columns[0] (a): scale must be positive and is allowed for decimal columns only"},
+		{Name: "Enum without values", Src: `{"columns": [{"name": "a", "type": "enum"}]}`, Error: "columns[0] (a): values are required for enum columns and allowed for them only"},
+		{Name: "Unknown version", Src: `{"columns": [{"name": "a", "type": "integer"}], "version": "v"}`, Error: `version: column "v" is not defined`},
+		{Name: "Version of string", Src: `{"columns": [{"name": "v", "type": "string"}], "version": "v"}`, Error: `version: column "v" must be stored integer, number or time`},
+		{Name: "Unknown deleted", Src: `{"columns": [{"name": "a", "type": "time"}], "deleted": "d"}`, Error: `deleted: column "d" is not defined`},
+		{Name: "Deleted of not time", Src: `{"columns": [{"name": "d", "type": "boolean"}], "deleted": "d"}`, Error: `deleted: column "d" must be stored time`},
+		{Name: "Search", Src: testSchema, Error: `search.columns[0]: column "tags" must be string`},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			s, err := LoadJSON([]byte(c.Src))
+			if err == nil {
+				t.Errorf("expected error, got: %v", s)
+				t.FailNow()
+			}
+			if !strings.Contains(err.Error(), c.Error) {
+				t.Errorf("expected error: %v, got: %v", c.Error, err)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestDumpJSON(t *testing.T) {
+	s := &Source{
+		Cols: NewCols(
+			NewCol(TypeString, "tags", "tags", true),
+			NewCol(TypeTime, "deleted", "deleted", false).WithHidden(),
+			&Col{Type: TypeNumber, Name: "id", DBName: "id", Required: true},
+			NewCol(TypeObject, "items", "items", true).WithChildTable("order_items", "id", "order_id").WithChildren(NewCols(
+				NewCol(TypeString, "sku", "sku", false),
+			)),
+			NewCol(TypeObject, "address", "addr", false).WithChildren(NewCols(
+				NewCol(TypeString, "zip", "zip", false).WithDenied(Filterable|Sortable),
+				NewCol(TypeString, "city", "city", false).WithRegex().WithRole("admin", AllCapabilities).WithRole("support", Selectable),
+			)),
+		),
+		Search:  &Search{Config: "english", Cols: []string{"tags"}},
+		Version: "id",
+		Deleted: "deleted",
+	}
+	buf, err := DumpJSON(s)
+	if err != nil {
+		t.Errorf("expected err: %v, got: %v", nil, err)
+		t.FailNow()
+	}
+	if string(buf) != testSchema {
+		t.Errorf("expected: %v, got: %v", testSchema, string(buf))
+		t.Fail()
+	}
+}
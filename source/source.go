@@ -12,8 +12,74 @@ const (
 	TypeBool
 	TypeTime
 	TypeObject
+	TypeInteger
+	TypeDecimal
+	TypeDate
+	TypeUUID
+	TypeEnum
+	TypeInterval
+	TypeJSON // raw JSON without known children
 )
 
+// Capability is an action with column allowed for clients
+type Capability int
+
+// capabilities
+const (
+	Filterable Capability = 1 << iota
+	Sortable
+	Selectable
+	Writable
+
+	AllCapabilities = Filterable | Sortable | Selectable | Writable
+)
+
+// capabilities contains names of capabilities
+var capabilities = map[Capability]string{
+	Filterable: "filter",
+	Sortable:   "sort",
+	Selectable: "select",
+	Writable:   "write",
+}
+
+// String returns name of capability
+func (c Capability) String() string {
+	var names []string
+	for _, capability := range []Capability{Filterable, Sortable, Selectable, Writable} {
+		if c&capability != 0 {
+			names = append(names, capabilities[capability])
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseCapability returns capability by name
+func ParseCapability(name string) (Capability, bool) {
+	for capability, n := range capabilities {
+		if n == name {
+			return capability, true
+		}
+	}
+	return 0, false
+}
+
+// Storage is a way to store array or object column
+type Storage int
+
+// storages
+const (
+	StorageJSON  Storage = iota // JSON or JSONB column
+	StorageArray                // native SQL array of scalars like text[] or int[]
+	StorageTable                // rows of child table, children are its columns
+)
+
+// ChildTable describes child table of column with StorageTable
+type ChildTable struct {
+	Table      string
+	Key        string // name of column of source
+	ForeignKey string // db name of column of child table that refers to key
+}
+
 // Col is a column
 type Col struct {
 	Type     Datatype
@@ -21,7 +87,16 @@ type Col struct {
 	Children Cols
 	Name     string
 	DBName   string
-	Required bool
+	Required bool // every query must constrain the column by =, <, <=, >, >= or list
+	Regex    bool
+	Scale    int      // max digits after decimal point of TypeDecimal, not limited if 0
+	Values   []string // allowed values of TypeEnum
+	Denied   Capability
+	Roles    map[string]Capability // capabilities allowed for roles, all roles are allowed if nil
+	Hidden   bool                  // internal column, it is not exposed to clients at all
+	Expr     string                // SQL expression of computed column used instead of DBName, {q} is replaced by alias of table
+	Storage  Storage
+	Child    *ChildTable // child table of column with StorageTable
 }
 
 // NewCol returns new Col
@@ -40,6 +115,105 @@ func (c *Col) WithChildren(cols Cols) *Col {
 	return c
 }
 
+// WithRegex allows regular expression matching on the column
+func (c *Col) WithRegex() *Col {
+	c.Regex = true
+	return c
+}
+
+// WithScale set max digits after decimal point for decimal column
+func (c *Col) WithScale(scale int) *Col {
+	c.Scale = scale
+	return c
+}
+
+// WithValues set allowed values for enum column
+func (c *Col) WithValues(values ...string) *Col {
+	c.Values = values
+	return c
+}
+
+// WithExpr makes the column computed by SQL expression like {q}.first || ' ' || {q}.last,
+// where {q} is replaced by alias of table
+func (c *Col) WithExpr(expr string) *Col {
+	c.Expr = expr
+	return c
+}
+
+// WithStorage set a storage of array or object column, StorageJSON by default
+func (c *Col) WithStorage(storage Storage) *Col {
+	c.Storage = storage
+	return c
+}
+
+// WithChildTable makes object or array of object column stored as rows of child table,
+// related rows are those where foreignKey equals key of source
+func (c *Col) WithChildTable(table, key, foreignKey string) *Col {
+	c.Storage = StorageTable
+	c.Child = &ChildTable{Table: table, Key: key, ForeignKey: foreignKey}
+	return c
+}
+
+// Relation returns relation to child table of column with StorageTable or nil,
+// it is one-to-one for object and one-to-many for array of object
+func (c *Col) Relation() *Relation {
+	if c.Storage != StorageTable || c.Child == nil {
+		return nil
+	}
+	cols := make(Cols, len(c.Children)+1)
+	for name, col := range c.Children {
+		cols[name] = col
+	}
+	if _, ok := cols[c.Child.ForeignKey]; !ok {
+		cols[c.Child.ForeignKey] = NewCol(TypeNumber, c.Child.ForeignKey, c.Child.ForeignKey, false).WithHidden()
+	}
+	rel := NewRelation(c.Name, c.Child.Table, &Source{Cols: cols}, c.Child.Key, c.Child.ForeignKey)
+	if !c.IsArray {
+		rel.WithKind(OneToOne)
+	}
+	return rel
+}
+
+// WithDenied denies capabilities of the column, e.g. Filterable|Sortable
+func (c *Col) WithDenied(capabilities Capability) *Col {
+	c.Denied |= capabilities
+	return c
+}
+
+// WithHidden hides the column from clients
+func (c *Col) WithHidden() *Col {
+	c.Hidden = true
+	return c
+}
+
+// Allows returns true if column is visible and capability is not denied
+func (c *Col) Allows(capability Capability) bool {
+	return !c.Hidden && c.Denied&capability == 0
+}
+
+// WithRole allows capabilities of the column for role, e.g. WithRole("support", Selectable|Filterable).
+// Once any role is set, other roles are not allowed anything
+func (c *Col) WithRole(role string, capabilities Capability) *Col {
+	if c.Roles == nil {
+		c.Roles = make(map[string]Capability)
+	}
+	c.Roles[role] |= capabilities
+	return c
+}
+
+// AllowsRoles returns true if capability is allowed for any of roles
+func (c *Col) AllowsRoles(roles []string, capability Capability) bool {
+	if c.Roles == nil {
+		return true
+	}
+	for _, role := range roles {
+		if c.Roles[role]&capability != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // Cols is a columns map
 type Cols map[string]*Col
 
@@ -78,6 +252,25 @@ func (c Cols) JSONPath(name string) (string, bool) {
 	return strings.Join(path[1:], ","), true
 }
 
+// Path returns columns chain by name, e.g. for a.b.c returns a, a.b and a.b.c.
+// Keys of raw JSON column are not declared, so they are returned as raw JSON columns
+func (c Cols) Path(name string) []*Col {
+	var path []*Col
+	cols := c
+	for _, part := range strings.Split(name, ".") {
+		col, ok := cols[part]
+		if len(path) > 0 && path[len(path)-1].Type == TypeJSON && part != "" {
+			col, ok = NewCol(TypeJSON, part, part, false), true
+		}
+		if !ok {
+			return nil
+		}
+		path = append(path, col)
+		cols = col.Children
+	}
+	return path
+}
+
 // Type returns columns datatype
 func (c Cols) Type(name string) *Datatype {
 	col := c.byName(name, c)
@@ -121,9 +314,88 @@ func (c Cols) pathByName(name string, cols Cols) []string {
 	return []string{col.DBName}
 }
 
+// Search describes columns that take part in full-text search over source
+type Search struct {
+	Config string   // text search configuration, simple by default
+	Cols   []string // names of string columns
+	Vector string   // db name of precomputed tsvector column, used instead of Cols
+}
+
+// RelationKind is a kind of relation
+type RelationKind int
+
+// relation kinds
+const (
+	OneToMany RelationKind = iota
+	OneToOne
+	ManyToMany
+)
+
+// Relation describes link to another source that can be used in subquery filters and embedded fields
+type Relation struct {
+	Name       string
+	Kind       RelationKind
+	Table      string  // table or view of related source
+	Source     *Source // columns of related source
+	Key        string  // name of column of this source
+	ForeignKey string  // name of column of related source, referencing Key
+	Link       *Link   // link table of many-to-many relation
+}
+
+// Link is a link table of many-to-many relation
+type Link struct {
+	Table      string
+	Key        string // db name of link column referencing Key of source
+	ForeignKey string // db name of link column referencing ForeignKey of related source
+}
+
+// NewRelation returns new one-to-many Relation, related rows are those where foreignKey equals key
+func NewRelation(name, table string, src *Source, key, foreignKey string) *Relation {
+	return &Relation{
+		Name:       name,
+		Table:      table,
+		Source:     src,
+		Key:        key,
+		ForeignKey: foreignKey,
+	}
+}
+
+// WithKind set a kind of relation
+func (r *Relation) WithKind(kind RelationKind) *Relation {
+	r.Kind = kind
+	return r
+}
+
+// WithLink set a link table and makes relation many-to-many,
+// related rows are those where foreignKey of relation equals linkForeignKey
+// of link rows where linkKey equals key of relation
+func (r *Relation) WithLink(table, linkKey, linkForeignKey string) *Relation {
+	r.Kind = ManyToMany
+	r.Link = &Link{Table: table, Key: linkKey, ForeignKey: linkForeignKey}
+	return r
+}
+
+// Relations is a relations map
+type Relations map[string]*Relation
+
+// NewRelations returns new Relations
+func NewRelations(relations ...*Relation) Relations {
+	r := Relations{}
+	for _, rel := range relations {
+		if rel != nil {
+			r[rel.Name] = rel
+		}
+	}
+	return r
+}
+
 // A Source is a columns list
 type Source struct {
-	Cols Cols
+	Cols      Cols
+	Search    *Search
+	Relations Relations
+	Version   string // name of integer, number or time column changed by every update, e.g. version or updated_at
+	Deleted   string // name of time column of soft delete, e.g. deleted_at, rows are not deleted while it is null
 	// Handlers map[string]Handler
 	// server   *Server
 }
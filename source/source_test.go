@@ -22,3 +22,49 @@ func TestJSONPath(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestPath(t *testing.T) {
+	cols := NewCols(
+		NewCol(TypeObject, "colA", "col_a", true).WithChildren(NewCols(
+			NewCol(TypeObject, "b", "some_b", false).WithChildren(NewCols(
+				NewCol(TypeString, "c", "c", false),
+			)),
+		)),
+	)
+
+	path := cols.Path("colA.b.c")
+	if len(path) != 3 {
+		t.Errorf("expected len: %v, got: %v", 3, len(path))
+		t.FailNow()
+	}
+	for i, name := range []string{"col_a", "some_b", "c"} {
+		if path[i].DBName != name {
+			t.Errorf("expected name: %v, got: %v", name, path[i].DBName)
+			t.Fail()
+		}
+	}
+	if path := cols.Path("colA.c"); path != nil {
+		t.Errorf("expected path: %v, got: %v", nil, path)
+		t.Fail()
+	}
+}
+
+func TestPathOfJSON(t *testing.T) {
+	cols := NewCols(NewCol(TypeJSON, "meta", "meta_data", false))
+
+	path := cols.Path("meta.a.b")
+	if len(path) != 3 {
+		t.Errorf("expected len: %v, got: %v", 3, len(path))
+		t.FailNow()
+	}
+	for i, name := range []string{"meta_data", "a", "b"} {
+		if path[i].DBName != name || path[i].Type != TypeJSON {
+			t.Errorf("expected json: %v, got: %v %v", name, path[i].Type, path[i].DBName)
+			t.Fail()
+		}
+	}
+	if path := cols.Path("meta..b"); path != nil {
+		t.Errorf("expected path: %v, got: %v", nil, path)
+		t.Fail()
+	}
+}
@@ -0,0 +1,189 @@
+package source
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// FromStruct returns Source with columns of exported fields of struct v or pointer to struct.
+// Field is described by tag like `w3sql:"colA,db=col_a,required,regex"`, where:
+// colA is a name of column, json name or name of field by default;
+// db is a name of column in database, snake case name of field by default
+// or json name for fields of nested structs, because they are stored as JSON;
+// required and regex set Required and Regex of column;
+// hidden hides column, nofilter, nosort and noselect deny capabilities of column;
+// storage=array makes slice of scalars a native SQL array instead of JSON.
+// Fields with tag `w3sql:"-"` are skipped, fields of embedded structs are promoted.
+func FromStruct(v interface{}) (*Source, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unable to build source: %v is not a struct", t)
+	}
+	cols, err := colsOf(t, t.Name(), false, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return &Source{Cols: cols}, nil
+}
+
+// colsOf returns columns of struct fields, path is used in errors, nested is true for structs stored as JSON
+func colsOf(t reflect.Type, path string, nested bool, visited map[reflect.Type]bool) (Cols, error) {
+	if visited[t] {
+		return nil, fmt.Errorf("unable to build source: field %v has recursive type %v", path, t)
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	cols := Cols{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("w3sql")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		fieldPath := path + "." + f.Name
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType {
+				embedded, err := colsOf(ft, fieldPath, nested, visited)
+				if err != nil {
+					return nil, err
+				}
+				for name, col := range embedded {
+					if _, ok := cols[name]; !ok {
+						cols[name] = col
+					}
+				}
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+		}
+		col, err := colOf(f, tag, fieldPath, nested, visited)
+		if err != nil {
+			return nil, err
+		}
+		cols[col.Name] = col
+	}
+	return cols, nil
+}
+
+// colOf returns column of struct field
+func colOf(f reflect.StructField, tag, path string, nested bool, visited map[reflect.Type]bool) (*Col, error) {
+	name := jsonName(f)
+	dbName := snakeCase(f.Name)
+	if nested {
+		dbName = name
+	}
+	col := &Col{}
+	parts := strings.Split(tag, ",")
+	if parts[0] != "" {
+		name = parts[0]
+	}
+	for _, opt := range parts[1:] {
+		switch {
+		case strings.HasPrefix(opt, "db="):
+			dbName = strings.TrimPrefix(opt, "db=")
+		case opt == "storage=array":
+			col.Storage = StorageArray
+		case opt == "required":
+			col.Required = true
+		case opt == "regex":
+			col.Regex = true
+		case opt == "hidden":
+			col.Hidden = true
+		case opt == "nofilter":
+			col.Denied |= Filterable
+		case opt == "nosort":
+			col.Denied |= Sortable
+		case opt == "noselect":
+			col.Denied |= Selectable
+		default:
+			return nil, fmt.Errorf("unable to build source: field %v has unknown option %q", path, opt)
+		}
+	}
+	col.Name, col.DBName = name, dbName
+
+	t := f.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8 {
+		col.IsArray = true
+		t = t.Elem()
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		col.Type = TypeString
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		col.Type = TypeInteger
+	case reflect.Float32, reflect.Float64:
+		col.Type = TypeNumber
+	case reflect.Bool:
+		col.Type = TypeBool
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unable to build source: field %v has unsupported type %v, map keys must be strings", path, f.Type)
+		}
+		col.Type = TypeObject
+	case reflect.Struct:
+		if t == timeType {
+			col.Type = TypeTime
+			break
+		}
+		children, err := colsOf(t, path, true, visited)
+		if err != nil {
+			return nil, err
+		}
+		col.Type = TypeObject
+		col.Children = children
+	default:
+		return nil, fmt.Errorf("unable to build source: field %v has unsupported type %v", path, f.Type)
+	}
+	if col.Storage == StorageArray && (!col.IsArray || col.Type == TypeObject) {
+		return nil, fmt.Errorf("unable to build source: field %v must be a slice of scalars to be stored as array", path)
+	}
+	return col, nil
+}
+
+// jsonName returns name of field from json tag or name of field
+func jsonName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
+
+// snakeCase returns name like CustomerID as customer_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			next := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && next) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
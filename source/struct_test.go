@@ -0,0 +1,117 @@
+package source
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testBase struct {
+	ID int64 `w3sql:"id,required"`
+}
+
+type testAddress struct {
+	City  string `json:"city"`
+	Zip   string `json:"zip_code"`
+	Lines []string
+}
+
+type testCustomer struct {
+	testBase
+	ColA      string            `w3sql:"colA,db=col_a,regex"`
+	Email     *string           `json:"email"`
+	Score     float64           `w3sql:"score"`
+	Active    bool              `w3sql:"active"`
+	CreatedAt time.Time         `w3sql:"createdAt"`
+	Tags      []string          `w3sql:"tags,storage=array"`
+	Address   testAddress       `w3sql:"address"`
+	History   []*testAddress    `w3sql:"history"`
+	Meta      map[string]string `w3sql:"meta"`
+	Phone     string            `w3sql:"phone,nofilter,noselect"`
+	Internal  string            `w3sql:"internal,hidden"`
+	Ignored   string            `w3sql:"-"`
+	secret    string
+}
+
+func TestFromStruct(t *testing.T) {
+	s, err := FromStruct(&testCustomer{})
+	if err != nil {
+		t.Errorf("expected err: %v, got: %v", nil, err)
+		t.FailNow()
+	}
+	address := NewCols(
+		NewCol(TypeString, "city", "city", false),
+		NewCol(TypeString, "zip_code", "zip_code", false),
+		NewCol(TypeString, "Lines", "Lines", true),
+	)
+	expected := NewCols(
+		&Col{Type: TypeInteger, Name: "id", DBName: "id", Required: true},
+		&Col{Type: TypeString, Name: "colA", DBName: "col_a", Regex: true},
+		NewCol(TypeString, "email", "email", false),
+		NewCol(TypeNumber, "score", "score", false),
+		NewCol(TypeBool, "active", "active", false),
+		NewCol(TypeTime, "createdAt", "created_at", false),
+		NewCol(TypeString, "tags", "tags", true).WithStorage(StorageArray),
+		NewCol(TypeObject, "address", "address", false).WithChildren(address),
+		NewCol(TypeObject, "history", "history", true).WithChildren(address),
+		NewCol(TypeObject, "meta", "meta", false),
+		NewCol(TypeString, "phone", "phone", false).WithDenied(Filterable|Selectable),
+		NewCol(TypeString, "internal", "internal", false).WithHidden(),
+	)
+	if !reflect.DeepEqual(s.Cols, expected) {
+		for name, col := range s.Cols {
+			if !reflect.DeepEqual(col, expected[name]) {
+				t.Errorf("expected col: %+v, got: %+v", expected[name], col)
+			}
+		}
+		t.Errorf("expected %v cols, got: %v", len(expected), len(s.Cols))
+		t.Fail()
+	}
+}
+
+type testRecursive struct {
+	Parent *testRecursive
+}
+
+func TestFromStructErrors(t *testing.T) {
+	cases := []struct {
+		Name string
+		V    interface{}
+	}{
+		{Name: "Not a struct", V: 1},
+		{Name: "Unsupported type", V: struct{ Fn func() }{}},
+		{Name: "Bytes", V: struct{ Raw []byte }{}},
+		{Name: "Array of arrays", V: struct{ Matrix [][]int }{}},
+		{Name: "Map with not string keys", V: struct{ M map[int]string }{}},
+		{Name: "Unknown option", V: struct {
+			A string `w3sql:"a,unique"`
+		}{}},
+		{Name: "Recursive type", V: testRecursive{}},
+		{Name: "Array storage of not slice", V: struct {
+			A string `w3sql:"a,storage=array"`
+		}{}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if s, err := FromStruct(c.V); err == nil {
+				t.Errorf("expected error, got: %v", s)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"ID":         "id",
+		"CustomerID": "customer_id",
+		"HTTPServer": "http_server",
+		"createdAt":  "created_at",
+		"Line2Name":  "line2_name",
+	} {
+		if got := snakeCase(name); got != expected {
+			t.Errorf("expected: %v, got: %v", expected, got)
+			t.Fail()
+		}
+	}
+}
@@ -13,25 +13,35 @@ const (
 	EOF
 
 	literalbeg
-	IDENT  // x
-	INT    // 123
-	FLOAT  // 1.23
-	STRING // "abc"
-	LIST   // {1,2,3}
-	PSEUDO // $count
+	IDENT    // x
+	INT      // 123
+	FLOAT    // 1.23
+	STRING   // "abc"
+	LIST     // {1,2,3}
+	PSEUDO   // $count
+	INTERVAL // 7d
 	literalend
 
 	operatorsbeg
 	AND // &
 	OR  // |
 
-	EQL  // = (behave like IN for LIST)
-	NEQ  // != (behave like NOT IN for LIST)
-	LSS  // <
-	LEQ  // <=
-	GTR  // >
-	GEQ  // >=
-	LIKE // ~=
+	EQL    // = (behave like IN for LIST)
+	NEQ    // != (behave like NOT IN for LIST)
+	LSS    // <
+	LEQ    // <=
+	GTR    // >
+	GEQ    // >=
+	LIKE   // ~=
+	ILIKE  // ~*=
+	PREFIX // ^=
+	SUFFIX // $=
+	IEQL   // *=
+	REGEX  // =~
+	MATCH  // @@
+
+	PLUS  // +
+	MINUS // -
 	operatorsend
 
 	NOT // !
@@ -44,9 +54,6 @@ const (
 	RBRACK // ]
 	RBRACE // }
 
-	PLUS  // +
-	MINUS // -
-
 	COMMA // ,
 	COLON // :
 	AT    // @
@@ -58,23 +65,33 @@ var tokens = [...]string{
 	ILLEGAL: "ILLEGAL",
 	EOF:     "EOF",
 
-	IDENT:  "IDENT",
-	INT:    "INT",
-	FLOAT:  "FLOAT",
-	STRING: "STRING",
-	LIST:   "LIST",
-	PSEUDO: "PSEUDO",
+	IDENT:    "IDENT",
+	INT:      "INT",
+	FLOAT:    "FLOAT",
+	STRING:   "STRING",
+	LIST:     "LIST",
+	PSEUDO:   "PSEUDO",
+	INTERVAL: "INTERVAL",
 
 	AND: "&",
 	OR:  "|",
 
-	EQL:  "=",
-	NEQ:  "!=",
-	LSS:  "<",
-	LEQ:  "<=",
-	GTR:  ">",
-	GEQ:  ">=",
-	LIKE: "~=",
+	EQL:    "=",
+	NEQ:    "!=",
+	LSS:    "<",
+	LEQ:    "<=",
+	GTR:    ">",
+	GEQ:    ">=",
+	LIKE:   "~=",
+	ILIKE:  "~*=",
+	PREFIX: "^=",
+	SUFFIX: "$=",
+	IEQL:   "*=",
+	REGEX:  "=~",
+	MATCH:  "@@",
+
+	PLUS:  "+",
+	MINUS: "-",
 
 	NOT: "!",
 
@@ -86,9 +103,6 @@ var tokens = [...]string{
 	RBRACK: "]",
 	RBRACE: "}",
 
-	PLUS:  "+",
-	MINUS: "-",
-
 	COMMA: ",",
 	COLON: ":",
 	AT:    "@",
@@ -112,8 +126,10 @@ func (t Token) Precedence() int {
 		return 1
 	case AND:
 		return 2
-	case EQL, NEQ, LSS, LEQ, GTR, GEQ, LIKE:
+	case EQL, NEQ, LSS, LEQ, GTR, GEQ, LIKE, ILIKE, PREFIX, SUFFIX, IEQL, REGEX, MATCH:
 		return 3
+	case PLUS, MINUS:
+		return 4
 
 	default:
 		return 0
@@ -126,6 +142,16 @@ func (t Token) Precedence() int {
 // and basic type literals; it returns false otherwise.
 func (t Token) IsLiteral() bool { return literalbeg < t && t < literalend }
 
+// IsPattern returns true for string matching operators; it returns false otherwise.
+func (t Token) IsPattern() bool {
+	switch t {
+	case LIKE, ILIKE, PREFIX, SUFFIX, IEQL, REGEX:
+		return true
+	default:
+		return false
+	}
+}
+
 // IsOperator returns true for tokens corresponding to operators and
 // delimiters; it returns false otherwise.
 func (t Token) IsOperator() bool { return operatorsbeg < t && t < operatorsend }
@@ -0,0 +1,132 @@
+package webserver
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/x-foby/w3sql/query"
+	"github.com/x-foby/w3sql/token"
+)
+
+// grammar describes w3sql request
+const grammar = "Request is /{fields}@{path}?{filter}:{order}[{offset}:{limit}], " +
+	"every part except path is optional, e.g. /id,name@users?age>18&name~=\"bob\":-age[0:10]"
+
+// openAPIParameters describes parts of w3sql request. Parts are written in request URI as is, not as name=value,
+// so every description has position of part in grammar
+var openAPIParameters = []map[string]interface{}{
+	{
+		"name":        "fields",
+		"in":          "query",
+		"description": "Comma separated fields before @ in path: /{fields}@{path}, related fields are embedded like customer(name,email). All fields by default",
+		"schema":      map[string]interface{}{"type": "string"},
+	},
+	{
+		"name":          "filter",
+		"in":            "query",
+		"description":   "Condition after ?: ?{filter}, " + filterGrammar(),
+		"schema":        map[string]interface{}{"type": "string"},
+		"allowReserved": true,
+	},
+	{
+		"name":          "order",
+		"in":            "query",
+		"description":   "Sort after condition and :, comma separated fields prefixed by + (asc) or - (desc), e.g. :-age,+name",
+		"schema":        map[string]interface{}{"type": "string"},
+		"allowReserved": true,
+	},
+	{
+		"name":          "limits",
+		"in":            "query",
+		"description":   "Offset and limit in brackets at the end, e.g. [20:10]",
+		"schema":        map[string]interface{}{"type": "string"},
+		"allowReserved": true,
+	},
+}
+
+// filterGrammar returns description of operators of token table and functions of query
+func filterGrammar() string {
+	var comparisons []string
+	for t := token.ILLEGAL; t <= token.QUO; t++ {
+		if t.IsOperator() && t.Precedence() == token.EQL.Precedence() {
+			comparisons = append(comparisons, t.String())
+		}
+	}
+	functions := make([]string, 0, len(query.Functions))
+	for example, description := range query.Functions {
+		functions = append(functions, example+" ("+description+")")
+	}
+	sort.Strings(functions)
+	return "comparisons " + strings.Join(comparisons, " ") + " (= and != with list like a={1,2} are in and not in) " +
+		"joined by " + token.AND.String() + " (and) and " + token.OR.String() + " (or), negated by " + token.NOT.String() +
+		", grouped by (), objects and arrays of objects are filtered like a={b=1,c>2}; functions: " + strings.Join(functions, "; ")
+}
+
+// WithOpenAPI serves OpenAPI document of routes on path for GET requests
+func (w3 *Server) WithOpenAPI(path, title, version string) *Server {
+	w3.openAPIPath = path
+	w3.openAPITitle = title
+	w3.openAPIVersion = version
+	return w3
+}
+
+// OpenAPI returns OpenAPI 3 document with registered routes and JSON Schemas of sources
+func (w3 *Server) OpenAPI(title, version string) map[string]interface{} {
+	paths := make(map[string]interface{}, len(w3.sources))
+	schemas := make(map[string]interface{}, len(w3.sources))
+	for path, s := range w3.sources {
+		name := schemaName(path)
+		schemas[name] = s.Source.JSONSchema()
+
+		operations := make(map[string]interface{}, len(s.Handlers))
+		for method := range s.Handlers {
+			operations[strings.ToLower(method)] = map[string]interface{}{
+				"operationId": strings.ToLower(method) + "_" + name,
+				"description": grammar,
+				"parameters":  openAPIParameters,
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "Rows of " + path,
+						"content": map[string]interface{}{
+							"application/json": map[string]interface{}{
+								"schema": map[string]interface{}{
+									"type":  "array",
+									"items": map[string]interface{}{"$ref": "#/components/schemas/" + name},
+								},
+							},
+						},
+					},
+					"default": map[string]interface{}{"description": "Error"},
+				},
+			}
+		}
+		paths["/"+path] = operations
+	}
+	return map[string]interface{}{
+		"openapi":    "3.0.3",
+		"info":       map[string]interface{}{"title": title, "version": version},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// schemaName returns name of schema of source by route path
+func schemaName(path string) string {
+	if path == "" {
+		return "root"
+	}
+	return strings.Replace(path, "/", "_", -1)
+}
+
+// serveOpenAPI writes OpenAPI document
+func (w3 *Server) serveOpenAPI(w http.ResponseWriter) {
+	buf, err := marshalJSON(w3.OpenAPI(w3.openAPITitle, w3.openAPIVersion), w3.prettyJSON)
+	if err != nil {
+		w3.error(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/x-foby/w3sql/parser"
 	"github.com/x-foby/w3sql/query"
 	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
 )
 
 // Context contains Query and Request per every http-request
@@ -20,6 +21,39 @@ type Context struct {
 	Query  *query.Query
 	W      http.ResponseWriter
 	R      *http.Request
+	Roles  []string
+}
+
+// mimeJSONPatch is a content type of JSON Patch (RFC 6902) request bodies
+const mimeJSONPatch = "application/json-patch+json"
+
+// CompilePatch returns update of target by body of PATCH request and its arguments. Body is a JSON Patch
+// if content type is application/json-patch+json, otherwise it is a JSON Merge Patch
+func (ctx Context) CompilePatch(target string) (string, []interface{}, error) {
+	var doc interface{}
+	d := json.NewDecoder(ctx.R.Body)
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return "", nil, err
+	}
+	if strings.HasPrefix(ctx.R.Header.Get("Content-Type"), mimeJSONPatch) {
+		return ctx.Query.CompileJSONPatch(target, doc)
+	}
+	return ctx.Query.CompileMergePatch(target, doc)
+}
+
+// SetVersion set ETag of response by value of version column, clients send it back in If-Match header.
+// Server derives ETag from response only if it is a JSON object with version column, so handler must set it
+// for other responses, e.g. arrays or objects wrapped in envelope
+func (ctx Context) SetVersion(version interface{}) error {
+	buf, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+	if etag := etagOfValue(string(buf)); etag != "" {
+		ctx.W.Header().Set("ETag", etag)
+	}
+	return nil
 }
 
 // Handler is a callback that will be call per every http-request
@@ -32,12 +66,32 @@ type Option int
 const (
 	OptJSONResult = iota + 1
 	OptPrettyJSON
+	OptDropDenied // drop fields that are not allowed for roles instead of error
 )
 
+// ErrPreconditionFailed must be returned by handler if mutation guarded by If-Match header changed nothing,
+// server replies 412 Precondition Failed
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ErrPreconditionRequired is replied with 428 Precondition Required if PUT, PATCH or DELETE of source
+// with version column has no If-Match header. If-Match: * changes rows of any version
+var ErrPreconditionRequired = errors.New("If-Match header is required")
+
+// Roles returns roles of client of request, e.g. from token
+type Roles func(r *http.Request) []string
+
+// Policy returns mandatory condition of request, e.g. tenant_id=1 for tenant of user
+type Policy func(r *http.Request) (ast.Expr, error)
+
+// Permit returns true if request is permitted something, e.g. to see soft-deleted rows
+type Permit func(r *http.Request) bool
+
 // SourceHandlers contains source and handlers
 type SourceHandlers struct {
-	Source   *source.Source
-	Handlers map[string]Handler
+	Source       *source.Source
+	Handlers     map[string]Handler
+	Policy       Policy
+	AllowDeleted Permit // permits $withDeleted flag of soft-deleted rows
 }
 
 // NewSourceHandlers return new NewSourceHandlers
@@ -48,6 +102,19 @@ func NewSourceHandlers(s *source.Source) *SourceHandlers {
 	}
 }
 
+// WithPolicy set policy that is joined with condition of every request by and before handler,
+// and with conditions of subqueries and embedded fields that read its source in requests of other routes
+func (s *SourceHandlers) WithPolicy(p Policy) *SourceHandlers {
+	s.Policy = p
+	return s
+}
+
+// WithAllowDeleted set permit of $withDeleted flag that includes soft-deleted rows, it is denied by default
+func (s *SourceHandlers) WithAllowDeleted(p Permit) *SourceHandlers {
+	s.AllowDeleted = p
+	return s
+}
+
 // Get is a handler for GET method
 func (s *SourceHandlers) Get(h Handler) *SourceHandlers {
 	return s.registerHandler(http.MethodGet, h)
@@ -102,14 +169,21 @@ func (s *SourceHandlers) registerHandler(m string, h Handler) *SourceHandlers {
 type Server struct {
 	resultAsJSON bool
 	prettyJSON   bool
+	dropDenied   bool
 	errorHandler func(status int, err error) []byte
+	roles        Roles
 	sources      map[string]*SourceHandlers
+
+	openAPIPath    string
+	openAPITitle   string
+	openAPIVersion string
 }
 
 // NewServer return new Server
 func NewServer(options ...Option) *Server {
 	return &Server{
 		resultAsJSON: contains(options, OptJSONResult),
+		dropDenied:   contains(options, OptDropDenied),
 		sources:      make(map[string]*SourceHandlers),
 	}
 }
@@ -142,6 +216,12 @@ func (w3 *Server) SetErrorHandler(errorHandler func(status int, err error) []byt
 	return w3
 }
 
+// WithRoles set function that returns roles of client, roles restrict columns of every query
+func (w3 *Server) WithRoles(roles Roles) *Server {
+	w3.roles = roles
+	return w3
+}
+
 // ServeHTTP is a default w3sql-handler
 func (w3 *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w3.serveHTTP(w, r, nil)
@@ -153,6 +233,11 @@ func (w3 *Server) ServeHTTPWithGlobals(w http.ResponseWriter, r *http.Request, g
 }
 
 func (w3 *Server) serveHTTP(w http.ResponseWriter, r *http.Request, globals map[string]ast.Expr) {
+	if w3.openAPIPath != "" && r.Method == http.MethodGet && r.URL.Path == w3.openAPIPath {
+		w3.serveOpenAPI(w)
+		return
+	}
+
 	src, err := url.QueryUnescape(strings.Replace(r.URL.RequestURI(), "+", "$add$", -1))
 	if err != nil {
 		w3.error(w, http.StatusBadRequest, err)
@@ -184,7 +269,50 @@ func (w3 *Server) serveHTTP(w http.ResponseWriter, r *http.Request, globals map[
 		return
 	}
 
-	status, data, err := h(Context{w3, q.WithSource(s.Source), w, r})
+	if s.Policy != nil {
+		policy, err := s.Policy(r)
+		if err == nil && policy == nil {
+			err = errors.New("policy has no condition for " + method + " " + path)
+		}
+		if err != nil {
+			w3.error(w, http.StatusForbidden, err)
+			return
+		}
+		q.WithPolicy(policy)
+	}
+	q.WithRelatedPolicy(w3.relatedPolicy(r))
+
+	if s.Source.Version != "" && (method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete) {
+		header := strings.TrimSpace(r.Header.Get("If-Match"))
+		if header == "" {
+			w3.error(w, http.StatusPreconditionRequired, ErrPreconditionRequired)
+			return
+		}
+		versions, ok := parseIfMatch(header)
+		if !ok {
+			w3.error(w, http.StatusBadRequest, errors.New("malformed If-Match header: "+header))
+			return
+		}
+		q.WithVersion(versions...)
+	}
+
+	if s.AllowDeleted != nil {
+		q.WithDeletedAllowed(s.AllowDeleted(r))
+	}
+
+	var roles []string
+	if w3.roles != nil {
+		roles = w3.roles(r)
+	}
+	q.WithRoles(roles...)
+	if w3.dropDenied {
+		q.WithAccess(query.DropDenied)
+	}
+
+	status, data, err := h(Context{w3, q.WithSource(s.Source), w, r, roles})
+	if errors.Is(err, ErrPreconditionFailed) {
+		status = http.StatusPreconditionFailed
+	}
 	if err != nil {
 		w3.error(w, status, err)
 		return
@@ -199,10 +327,41 @@ func (w3 *Server) serveHTTP(w http.ResponseWriter, r *http.Request, globals map[
 		return
 	}
 
+	if s.Source.Version != "" && (method == http.MethodGet || method == http.MethodHead) && w.Header().Get("ETag") == "" {
+		if etag := etagOf(buf, s.Source.Version); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+	}
 	w.WriteHeader(status)
 	w.Write(buf)
 }
 
+// relatedPolicy returns policies of routes of related sources of request joined by and,
+// subqueries and embedded fields can not read rows that are not readable by routes of their sources
+func (w3 *Server) relatedPolicy(r *http.Request) query.RelatedPolicy {
+	return func(src *source.Source) (ast.Expr, error) {
+		var policy ast.Expr
+		for path, s := range w3.sources {
+			if s.Source != src || s.Policy == nil {
+				continue
+			}
+			expr, err := s.Policy(r)
+			if err == nil && expr == nil {
+				err = errors.New("policy has no condition for " + path)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if policy == nil {
+				policy = expr
+			} else {
+				policy = ast.NewBinaryExpr(token.AND, policy, expr, 0)
+			}
+		}
+		return policy, nil
+	}
+}
+
 func (w3 *Server) error(w http.ResponseWriter, code int, err error) {
 	w.WriteHeader(code)
 	if !w3.resultAsJSON {
@@ -223,6 +382,46 @@ func (w3 *Server) error(w http.ResponseWriter, code int, err error) {
 	w.Write(buf)
 }
 
+// parseIfMatch returns versions of If-Match header like "1", W/"2", no versions for *.
+// Weak entity tags are accepted, because proxies weaken entity tags of compressed responses.
+// Returns false if header is malformed
+func parseIfMatch(header string) ([]string, bool) {
+	if header == "*" {
+		return nil, true
+	}
+	tags := strings.Split(header, ",")
+	versions := make([]string, len(tags))
+	for i, tag := range tags {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			return nil, false
+		}
+		versions[i] = tag[1 : len(tag)-1]
+	}
+	return versions, true
+}
+
+// etagOf returns entity tag of JSON object by value of version, nothing if buf is not an object with version
+func etagOf(buf []byte, version string) string {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &object); err != nil {
+		return ""
+	}
+	return etagOfValue(string(object[version]))
+}
+
+// etagOfValue returns entity tag of JSON value of version, nothing if value is null, object or array
+func etagOfValue(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "null" || value[0] == '{' || value[0] == '[' {
+		return ""
+	}
+	if value[0] == '"' {
+		return value
+	}
+	return `"` + value + `"`
+}
+
 func contains(options []Option, option Option) bool {
 	for _, o := range options {
 		if o == option {
@@ -0,0 +1,273 @@
+package webserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/x-foby/w3sql/ast"
+	"github.com/x-foby/w3sql/source"
+	"github.com/x-foby/w3sql/token"
+)
+
+func versionedServer(t *testing.T, versions *[]string) *Server {
+	src := &source.Source{
+		Cols: source.NewCols(
+			source.NewCol(source.TypeNumber, "id", "id", false),
+			source.NewCol(source.TypeNumber, "version", "version", false),
+		),
+		Version: "version",
+	}
+	handlers := NewSourceHandlers(src).
+		Get(func(ctx Context) (int, interface{}, error) {
+			return http.StatusOK, map[string]interface{}{"id": 7, "version": 3}, nil
+		}).
+		Patch(func(ctx Context) (int, interface{}, error) {
+			*versions = ctx.Query.Versions()
+			if len(*versions) > 0 && (*versions)[0] == "2" {
+				return 0, nil, ErrPreconditionFailed
+			}
+			return http.StatusOK, nil, nil
+		})
+	w3 := NewServer()
+	if err := w3.Route("orders", handlers); err != nil {
+		t.Fatal(err)
+	}
+	return w3
+}
+
+func TestIfMatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		ifMatch  string
+		status   int
+		versions []string
+	}{
+		{name: "Missing", status: http.StatusPreconditionRequired},
+		{name: "Any", ifMatch: "*", status: http.StatusOK},
+		{name: "Strong", ifMatch: `"3"`, status: http.StatusOK, versions: []string{"3"}},
+		{name: "Weak", ifMatch: `W/"3"`, status: http.StatusOK, versions: []string{"3"}},
+		{name: "List", ifMatch: `"3", W/"4"`, status: http.StatusOK, versions: []string{"3", "4"}},
+		{name: "Malformed", ifMatch: "3", status: http.StatusBadRequest},
+		{name: "Changed", ifMatch: `"2"`, status: http.StatusPreconditionFailed, versions: []string{"2"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var versions []string
+			w3 := versionedServer(t, &versions)
+			r := httptest.NewRequest(http.MethodPatch, "/orders?id=7", strings.NewReader("{}"))
+			if c.ifMatch != "" {
+				r.Header.Set("If-Match", c.ifMatch)
+			}
+			w := httptest.NewRecorder()
+			w3.ServeHTTP(w, r)
+			if w.Code != c.status {
+				t.Fatalf("expected status %d, got %d: %s", c.status, w.Code, w.Body.String())
+			}
+			if !reflect.DeepEqual(versions, c.versions) {
+				t.Errorf("expected versions %v, got %v", c.versions, versions)
+			}
+		})
+	}
+}
+
+func TestETag(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler Handler
+		etag    string
+	}{
+		{
+			name: "Object",
+			handler: func(ctx Context) (int, interface{}, error) {
+				return http.StatusOK, map[string]interface{}{"id": 7, "version": 3}, nil
+			},
+			etag: `"3"`,
+		},
+		{
+			name: "Array",
+			handler: func(ctx Context) (int, interface{}, error) {
+				return http.StatusOK, []interface{}{map[string]interface{}{"id": 7, "version": 3}}, nil
+			},
+		},
+		{
+			name: "Array with version",
+			handler: func(ctx Context) (int, interface{}, error) {
+				return http.StatusOK, []interface{}{map[string]interface{}{"id": 7, "version": 3}}, ctx.SetVersion(3)
+			},
+			etag: `"3"`,
+		},
+		{
+			name: "Wrapped object with version",
+			handler: func(ctx Context) (int, interface{}, error) {
+				data := map[string]interface{}{"data": map[string]interface{}{"id": 7, "rev": "2020-05-17T10:30:00Z"}}
+				return http.StatusOK, data, ctx.SetVersion("2020-05-17T10:30:00Z")
+			},
+			etag: `"2020-05-17T10:30:00Z"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			src := &source.Source{
+				Cols: source.NewCols(
+					source.NewCol(source.TypeNumber, "id", "id", false),
+					source.NewCol(source.TypeNumber, "version", "version", false),
+				),
+				Version: "version",
+			}
+			w3 := NewServer()
+			if err := w3.Route("orders", NewSourceHandlers(src).Get(c.handler)); err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			w3.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders?id=7", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if etag := w.Header().Get("ETag"); etag != c.etag {
+				t.Errorf("expected ETag %s, got %s", c.etag, etag)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := ast.NewBinaryExpr(token.EQL, ast.NewIdent("id", 0), ast.NewConst("7", 0, token.INT), 0)
+	cases := []struct {
+		name   string
+		policy Policy
+		status int
+		expect ast.Expr
+	}{
+		{
+			name:   "Condition",
+			policy: func(r *http.Request) (ast.Expr, error) { return policy, nil },
+			status: http.StatusOK,
+			expect: policy,
+		},
+		{
+			name:   "Error",
+			policy: func(r *http.Request) (ast.Expr, error) { return nil, errors.New("no tenant") },
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "No condition",
+			policy: func(r *http.Request) (ast.Expr, error) { return nil, nil },
+			status: http.StatusForbidden,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got ast.Expr
+			src := &source.Source{Cols: source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false))}
+			handlers := NewSourceHandlers(src).
+				WithPolicy(c.policy).
+				Get(func(ctx Context) (int, interface{}, error) {
+					got = ctx.Query.Policy()
+					return http.StatusOK, []interface{}{}, nil
+				})
+			w3 := NewServer()
+			if err := w3.Route("orders", handlers); err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			w3.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+			if w.Code != c.status {
+				t.Fatalf("expected status %d, got %d: %s", c.status, w.Code, w.Body.String())
+			}
+			if got != c.expect {
+				t.Errorf("expected policy %v, got %v", c.expect, got)
+			}
+		})
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	w3 := versionedServer(t, new([]string)).WithOpenAPI("/openapi.json", "Orders", "1.0")
+	w := httptest.NewRecorder()
+	w3.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected content type application/json, got %s", ct)
+	}
+	var doc struct {
+		Info  map[string]string
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Parameters  []struct {
+				Name        string
+				In          string
+				Description string
+			}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Info["title"] != "Orders" || doc.Info["version"] != "1.0" {
+		t.Errorf("unexpected info %v", doc.Info)
+	}
+	operations := doc.Paths["/orders"]
+	if len(operations) != 2 {
+		t.Fatalf("expected get and patch of /orders, got %v", doc.Paths)
+	}
+	get := operations["get"]
+	if get.OperationID != "get_orders" {
+		t.Errorf("expected operation get_orders, got %s", get.OperationID)
+	}
+	if len(get.Parameters) != 4 {
+		t.Fatalf("expected fields, filter, order and limits, got %v", get.Parameters)
+	}
+	filter := get.Parameters[1]
+	if filter.Name != "filter" || filter.In != "query" {
+		t.Fatalf("expected filter in query, got %s in %s", filter.Name, filter.In)
+	}
+	for _, expect := range []string{"~*=", "^=", "$=", "*=", "=~", "@@", "any", "length(", "has(", "startof(", "$exists", "@orders.", "$search", "$rank", "$withDeleted", "$outer."} {
+		if !strings.Contains(filter.Description, expect) {
+			t.Errorf("expected %s in description of filter: %s", expect, filter.Description)
+		}
+	}
+}
+
+func TestRelatedPolicy(t *testing.T) {
+	orders := &source.Source{
+		Cols: source.NewCols(
+			source.NewCol(source.TypeNumber, "customer_id", "customer_id", false),
+			source.NewCol(source.TypeNumber, "tenant", "tenant_id", false).WithHidden(),
+		),
+	}
+	customers := &source.Source{
+		Cols:      source.NewCols(source.NewCol(source.TypeNumber, "id", "id", false)),
+		Relations: source.NewRelations(source.NewRelation("orders", "orders", orders, "id", "customer_id")),
+	}
+	var sql string
+	w3 := NewServer()
+	err := w3.Route("customers", NewSourceHandlers(customers).Get(func(ctx Context) (int, interface{}, error) {
+		var err error
+		sql, err = ctx.Query.Compile("customers")
+		return http.StatusOK, []interface{}{}, err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w3.Route("orders", NewSourceHandlers(orders).WithPolicy(func(r *http.Request) (ast.Expr, error) {
+		return ast.NewBinaryExpr(token.EQL, ast.NewIdent("tenant", 0), ast.NewConst("7", 0, token.INT), 0), nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	w3.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/customers?$exists(orders)", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if expect := "select * from customers q where exists (select 1 from orders r where r.customer_id = q.id and r.tenant_id = 7)"; sql != expect {
+		t.Errorf("expected %s, got %s", expect, sql)
+	}
+}